@@ -18,23 +18,45 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"math/rand"
 	"os"
 	"path"
 	"time"
 
 	"github.com/golang/glog"
+	"k8s.io/client-go/kubernetes"
 
 	driver "github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/settings"
 )
 
 var (
 	endpoint      = flag.String("endpoint", "unix://tmp/csi.sock", "CSI endpoint")
 	driverName    = flag.String("drivername", "ibm-spectrum-scale-csi", "name of the driver")
 	nodeID        = flag.String("nodeid", "", "node id")
+	configSource  = flag.String("config-source", settings.ConfigSourceFile, "source of the Spectrum Scale configuration, \"file\" or \"kubernetes\"")
+	configPath    = flag.String("config-path", settings.ConfigMapFile, "path of the Spectrum Scale configuration file, used with config-source \"file\"")
+	configMap     = flag.String("configmap", settings.DefaultConfigMapName, "ConfigMap holding the Spectrum Scale configuration, used with config-source \"kubernetes\"")
+	configNs      = flag.String("config-namespace", "", "namespace of the Spectrum Scale configuration and secrets, defaults to the namespace of the driver")
+	kubeconfig    = flag.String("kubeconfig", "", "kubeconfig file, the in-cluster configuration is used if not specified")
+	stateSource   = flag.String("controller-state", stateFile, "where the controller service keeps its state, \"file\" for the plugin folder of the node or \"kubernetes\" for ConfigMaps in the namespace of the driver")
+	snapInterval  = flag.Duration("snapshot-scheduler-interval", 0, "interval in which the snapshot scheduler checks the filesets for scheduled snapshots, e.g. 5m, 0 disables the scheduler")
+	inodeInterval = flag.Duration("inode-expansion-interval", 0, "interval in which the inode usage of independent filesets is checked, 0 disables the inode expansion")
+	inodeThresh   = flag.Int("inode-expansion-threshold", 90, "percentage of the inode limit of a fileset in use at which the limit is raised")
+	inodeStep     = flag.Uint64("inode-expansion-step", 100000, "number of inodes the inode limit of a fileset is raised by")
+	inodeMax      = flag.Uint64("inode-expansion-max", 10000000, "maximum inode limit of a fileset raised by the inode expansion")
+	migrateVolume = flag.String("migrate-volume", "", "volume ID of a volume to migrate, the driver exits after the migration")
+	migrateFs     = flag.String("migrate-target-fs", "", "filesystem the volume is migrated to, as named in the primary cluster")
+	migrateCid    = flag.String("migrate-target-cluster", "", "ID of the cluster owning the target filesystem, defaults to the cluster of the volume")
 	vendorVersion = "1.0.0"
 )
 
+const (
+	stateFile       = "file"
+	stateKubernetes = "kubernetes"
+)
+
 func main() {
 	_ = flag.Set("logtostderr", "true")
 	flag.Parse()
@@ -56,13 +78,77 @@ func main() {
 
 func handle() {
 	driver := driver.GetScaleDriver()
+
+	switch *configSource {
+	case settings.ConfigSourceFile:
+		driver.SetConfigSource(settings.FileConfigSource{Path: *configPath})
+	case settings.ConfigSourceKubernetes:
+		source, err := settings.NewKubeConfigSource(*kubeconfig, *configNs, *configMap)
+		if err != nil {
+			glog.Fatalf("Failed to read Spectrum Scale configuration from kubernetes: %v", err)
+		}
+		driver.SetConfigSource(source)
+	default:
+		glog.Fatalf("Invalid config-source %s, valid values are %s and %s", *configSource, settings.ConfigSourceFile, settings.ConfigSourceKubernetes)
+	}
+
+	var client kubernetes.Interface
+	switch *stateSource {
+	case stateFile:
+	case stateKubernetes:
+		var err error
+		client, err = settings.NewKubeClient(*kubeconfig)
+		if err != nil {
+			glog.Fatalf("Failed to keep controller state in kubernetes: %v", err)
+		}
+		namespace, err := settings.GetNamespace(*configNs)
+		if err != nil {
+			glog.Fatalf("Failed to keep controller state in kubernetes: %v", err)
+		}
+		driver.SetKubeClient(client, namespace)
+	default:
+		glog.Fatalf("Invalid controller-state %s, valid values are %s and %s", *stateSource, stateFile, stateKubernetes)
+	}
+
+	if *inodeInterval > 0 && *migrateVolume == "" {
+		setupInodeExpansion(driver, client)
+	}
+
+	if *migrateVolume != "" {
+		if *migrateFs == "" {
+			glog.Fatalf("migrate-target-fs is required to migrate a volume")
+		}
+		*snapInterval = 0
+	}
+	driver.SetSnapshotSchedulerInterval(*snapInterval)
+
 	err := driver.SetupScaleDriver(*driverName, vendorVersion, *nodeID)
 	if err != nil {
 		glog.Fatalf("Failed to initialize Scale CSI Driver: %v", err)
 	}
+
+	if *migrateVolume != "" {
+		newVolumeID, err := driver.MigrateVolume(*migrateVolume, *migrateCid, *migrateFs)
+		if err != nil {
+			glog.Fatalf("Failed to migrate volume: %v", err)
+		}
+		fmt.Println(newVolumeID)
+		return
+	}
 	driver.Run(*endpoint)
 }
 
+// setupInodeExpansion enables the inode expansion of d, recording its changes
+// as events of the persistent volumes if the Kubernetes API is available.
+func setupInodeExpansion(d *driver.ScaleDriver, client kubernetes.Interface) {
+	d.SetInodeExpansion(driver.InodeExpansion{Interval: *inodeInterval, Threshold: *inodeThresh, Step: *inodeStep, Max: *inodeMax})
+	if client == nil {
+		glog.Warningf("Unable to record events of persistent volumes without kubernetes controller state, events are only logged")
+		return
+	}
+	d.SetEventRecorder(driver.NewKubeEventRecorder(client, *driverName))
+}
+
 func createPersistentStorage(persistentStoragePath string) error {
 	if _, err := os.Stat(persistentStoragePath); os.IsNotExist(err) {
 		if err := os.MkdirAll(persistentStoragePath, os.FileMode(0755)); err != nil {
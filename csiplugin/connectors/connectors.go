@@ -23,13 +23,22 @@ import (
 
 //go:generate counterfeiter -o ../../../fakes/fake_spectrum.go . SpectrumScaleConnector
 type SpectrumScaleConnector interface {
+	//Connection operations
+	UpdateCredentials(config settings.Clusters) error
 	//Cluster operations
 	GetClusterId() (string, error)
+	GetCesSummary() (CesSummary, error)
+	ListNodes() ([]Node_v2, error)
+	GetNode(nodeName string) (Node_v2, error)
 	//Filesystem operations
 	GetFilesystemMountDetails(filesystemName string) (MountInfo, error)
 	IsFilesystemMounted(filesystemName string) (bool, error)
 	ListFilesystems() ([]string, error)
 	GetFilesystemMountpoint(filesystemName string) (string, error)
+	ListStoragePools(filesystemName string) ([]string, error)
+	IsFilesystemEncryptionEnabled(filesystemName string) (bool, error)
+	GetFilesystemPolicy(filesystemName string) (string, error)
+	SetFilesystemPolicy(filesystemName string, policy string) error
 	//Fileset operations
 	CreateFileset(filesystemName string, filesetName string, opts map[string]interface{}) error
 	DeleteFileset(filesystemName string, filesetName string) error
@@ -38,14 +47,18 @@ type SpectrumScaleConnector interface {
 	UnlinkFileset(filesystemName string, filesetName string) error
 	//ListFilesets(filesystemName string) ([]resources.Volume, error)
 	ListFileset(filesystemName string, filesetName string) (Fileset_v2, error)
+	ListFilesets(filesystemName string) ([]Fileset_v2, error)
 	IsFilesetLinked(filesystemName string, filesetName string) (bool, error)
+	SetFilesetInodeLimit(filesystemName string, filesetName string, maxNumInodes string) error
 	//TODO modify quota from string to Capacity (see kubernetes)
 	ListFilesetQuota(filesystemName string, filesetName string) (string, error)
-	SetFilesetQuota(filesystemName string, filesetName string, quota string) error
+	SetFilesetQuota(filesystemName string, filesetName string, quota string, opts map[string]interface{}) error
+	GetFilesetQuotaDetails(filesystemName string, filesetName string) (Quota_v2, error)
 	CheckIfFSQuotaEnabled(filesystem string) error
 	//Directory operations
-	MakeDirectory(filesystemName string, relativePath string, uid string, gid string) error
-	MountFilesystem(filesystemName string, nodeName string) error
+	MakeDirectory(filesystemName string, relativePath string, uid string, gid string, permissions string) error
+	SetNFSv4ACL(filesystemName string, relativePath string, entries []ACLEntry) error
+	MountFilesystem(filesystemName string, nodeName string, mountOptions string) error
 	UnmountFilesystem(filesystemName string, nodeName string) error
 	GetFilesystemName(filesystemUUID string) (string, error)
 	CheckIfFileDirPresent(filesystemName string, relPath string) (bool, error)
@@ -55,6 +68,16 @@ type SpectrumScaleConnector interface {
 	GetFileSetUid(filesystemName string, filesetName string) (string, error)
 	GetFileSetNameFromId(filesystemName string, Id string) (string, error)
 	DeleteSymLnk(filesystemName string, LnkName string) error
+	CopyDirectory(filesystemName string, relativePath string, targetFs string, targetPath string) error
+	//Snapshot operations
+	ListFilesetSnapshots(filesystemName string, filesetName string) ([]Snapshot_v2, error)
+	CreateFilesetSnapshot(filesystemName string, filesetName string, snapshotName string) error
+	DeleteFilesetSnapshot(filesystemName string, filesetName string, snapshotName string) error
+	//CES NFS export operations
+	IsNfsExported(exportPath string) (bool, error)
+	ListNfsExports(filesystemName string) ([]NfsExport, error)
+	CreateNfsExport(exportPath string, clients []string) error
+	DeleteNfsExport(exportPath string) error
 }
 
 const (
@@ -68,6 +91,37 @@ const (
 	UserSpecifiedParentFset     string = "parentFileset"
 	UserSpecifiedVolBackendFs   string = "volBackendFs"
 	UserSpecifiedVolDirPath     string = "volDirBasePath"
+	UserSpecifiedMountOptions   string = "mountOptions"
+	UserSpecifiedStoragePool    string = "storagePool"
+	UserSpecifiedQuotaEnforce   string = "quotaEnforcement"
+	UserSpecifiedFsetNameTpl    string = "filesetNameTemplate"
+	UserSpecifiedVolPathMode    string = "volumePathMode"
+	UserSpecifiedPrimaryName    string = "primaryName"
+	UserSpecifiedAfmMode        string = "afmMode"
+	UserSpecifiedAfmTarget      string = "afmTarget"
+	UserSpecifiedAfmAsyncDelay  string = "afmAsyncDelay"
+	UserSpecifiedIamMode        string = "iamMode"
+	UserSpecifiedRetention      string = "retentionPeriodInfo"
+	UserSpecifiedPermChangeMode string = "permissionChangeMode"
+	UserSpecifiedPermissions    string = "permissions"
+	UserSpecifiedNFSv4Acl       string = "nfsv4Acl"
+	UserSpecifiedNfsExport      string = "nfsExport"
+	UserSpecifiedSnapSchedule   string = "snapshotSchedule"
+	UserSpecifiedEncryptionKey  string = "encryptionKey"
+	UserSpecifiedEncryptionAlgo string = "encryptionAlgorithm"
+	UserSpecifiedPolicyTemplate string = "policyTemplate"
+
+	// Fileset option set by the driver
+	FilesetComment string = "comment"
+
+	UserSpecifiedFilesHardLimit   string = "filesHardLimit"
+	UserSpecifiedFilesSoftLimit   string = "filesSoftLimit"
+	UserSpecifiedBlockSoftLimitPc string = "blockSoftLimitPercent"
+	UserSpecifiedBlockGracePeriod string = "blockGracePeriod"
+	UserSpecifiedFilesGracePeriod string = "filesGracePeriod"
+
+	// Quota option computed from the volume size and blockSoftLimitPercent
+	QuotaBlockSoftLimit string = "blockSoftLimit"
 )
 
 func GetSpectrumScaleConnector(config settings.Clusters) (SpectrumScaleConnector, error) {
@@ -237,6 +237,43 @@ type NfsExportRequest struct {
 	ClientDetail []string `json:"nfsClients,omitempty"`
 }
 
+type Snapshot_v2 struct {
+	SnapshotName   string `json:"snapshotName,omitempty"`
+	FilesystemName string `json:"filesystemName,omitempty"`
+	FilesetName    string `json:"filesetName,omitempty"`
+	SnapID         int    `json:"snapID,omitempty"`
+	Status         string `json:"status,omitempty"`
+	Created        string `json:"created,omitempty"`
+}
+
+type GetSnapshotResponse_v2 struct {
+	Snapshots []Snapshot_v2 `json:"snapshots,omitempty"`
+	Status    Status        `json:"status,omitempty"`
+	Paging    Pages         `json:"paging,omitempty"`
+}
+
+type CreateSnapshotRequest struct {
+	SnapshotName string `json:"snapshotName"`
+}
+
+type CopyPathRequest struct {
+	TargetFilesystem string `json:"targetFilesystem"`
+	TargetPath       string `json:"targetPath"`
+}
+
+type NfsExport struct {
+	FilesystemName string `json:"filesystemName,omitempty"`
+	Path           string `json:"path,omitempty"`
+	Delegations    string `json:"delegations,omitempty"`
+	Pseudopath     string `json:"pseudoPath,omitempty"`
+}
+
+type GetNfsExportResponse struct {
+	Exports []NfsExport `json:"exports,omitempty"`
+	Status  Status      `json:"status,omitempty"`
+	Paging  Pages       `json:"paging,omitempty"`
+}
+
 type GetQuotaResponse struct {
 	Links  map[string]string `json:"links,omitempty"`
 	Quotas []Quota           `json:"quotas,omitempty"`
@@ -450,6 +487,19 @@ type Fileset_v2 struct {
 	AFM         AFM              `json:"afm,omitempty"`
 	Config      FilesetConfig_v2 `json:"config,omitempty"`
 	FilesetName string           `json:"filesetName,omitempty"`
+	Usage       FilesetUsage_v2  `json:"usage,omitempty"`
+}
+
+type FilesetUsage_v2 struct {
+	AllocatedInodes      int `json:"allocatedInodes,omitempty"`
+	InodeSpaceFreeInodes int `json:"inodeSpaceFreeInodes,omitempty"`
+	InodeSpaceUsedInodes int `json:"inodeSpaceUsedInodes,omitempty"`
+	UsedBytes            int `json:"usedBytes,omitempty"`
+	UsedInodes           int `json:"usedInodes,omitempty"`
+}
+
+type UpdateFilesetRequest struct {
+	MaxNumInodes string `json:"maxNumInodes,omitempty"`
 }
 
 type GetFilesetResponse_v2 struct {
@@ -464,6 +514,7 @@ type FilesetConfig_v2 struct {
 	Path                 string `json:"path,omitempty"`
 	InodeSpace           int    `json:"inodeSpace,omitempty"`
 	MaxNumInodes         int    `json:"maxNumInodes,omitempty"`
+	AllocInodes          int    `json:"allocInodes,omitempty"`
 	PermissionChangeMode string `json:"permissionChangeMode,omitempty"`
 	Comment              string `json:"comment,omitempty"`
 	IamMode              string `json:"iamMode,omitempty"`
@@ -516,6 +567,33 @@ type SetQuotaRequest_v2 struct {
 	ObjectName       string `json:"objectName,omitempty"`
 }
 
+type GetStoragePoolsResponse_v2 struct {
+	StoragePools []StoragePool_v2 `json:"storagePool,omitempty"`
+	Status       Status           `json:"status,omitempty"`
+	Paging       Pages            `json:"paging,omitempty"`
+}
+
+type StoragePool_v2 struct {
+	FilesystemName  string `json:"filesystemName,omitempty"`
+	StoragePoolName string `json:"storagePoolName,omitempty"`
+	TotalDataSize   int    `json:"totalDataSize,omitempty"`
+	FreeDataSize    int    `json:"freeDataSize,omitempty"`
+}
+
+type GetPolicyResponse_v2 struct {
+	Policies []Policy_v2 `json:"policies,omitempty"`
+	Status   Status      `json:"status,omitempty"`
+}
+
+type Policy_v2 struct {
+	FilesystemName string `json:"filesystemName,omitempty"`
+	Policy         string `json:"policy,omitempty"`
+}
+
+type SetPolicyRequest_v2 struct {
+	Policy string `json:"policy"`
+}
+
 type LinkFilesetRequest struct {
 	Path string `json:"path,omitempty"`
 }
@@ -555,10 +633,23 @@ type CreateFilesetRequest struct {
 }
 
 type CreateMakeDirRequest struct {
-	UID   string `json:"uid,omitempty"`   //uidnumber
-	GID   string `json:"gid,omitempty"`   //gidnumber
-	USER  string `json:"user,omitempty"`  //username
-	GROUP string `json:"group,omitempty"` //groupname
+	UID         string `json:"uid,omitempty"`         //uidnumber
+	GID         string `json:"gid,omitempty"`         //gidnumber
+	USER        string `json:"user,omitempty"`        //username
+	GROUP       string `json:"group,omitempty"`       //groupname
+	PERMISSIONS string `json:"permissions,omitempty"` //octal mode
+}
+
+type ACLEntry struct {
+	Type        string `json:"type"`
+	Who         string `json:"who"`
+	Permissions string `json:"permissions"`
+	Flags       string `json:"flags,omitempty"`
+}
+
+type SetACLRequest struct {
+	Type    string     `json:"type"`
+	Entries []ACLEntry `json:"entries"`
 }
 
 type SymLnkRequest struct {
@@ -22,8 +22,10 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/settings"
@@ -34,12 +36,26 @@ import (
 )
 
 type spectrumRestV2 struct {
+	endpoint string
+
+	// mux guards the credentials, which are updated when secrets change
+	mux        sync.RWMutex
 	httpClient *http.Client
-	endpoint   string
 	user       string
 	password   string
 }
 
+// notFoundMessageRegex matches the messages of the GUI for objects that do not
+// exist, some of which are reported with status 400.
+var notFoundMessageRegex = regexp.MustCompile(`(?i)not found|does not exist`)
+
+// isNotFound returns true if the GUI reported that the requested object does
+// not exist. Other errors with status 400, e.g. invalid requests, are not.
+func isNotFound(responseStatus Status) bool {
+	return responseStatus.Code == http.StatusNotFound ||
+		(responseStatus.Code == http.StatusBadRequest && notFoundMessageRegex.MatchString(responseStatus.Message))
+}
+
 func (s *spectrumRestV2) isStatusOK(statusCode int) bool {
 	glog.V(4).Infof("rest_v2 isStatusOK. statusCode: %d", statusCode)
 
@@ -117,20 +133,34 @@ func NewSpectrumRestV2(scaleConfig settings.Clusters) (SpectrumScaleConnector, e
 	glog.V(4).Infof("rest_v2 NewSpectrumRestV2.")
 
 	guiHost := scaleConfig.RestAPI[0].GuiHost
-	guiUser := scaleConfig.MgmtUsername
-	guiPwd := scaleConfig.MgmtPassword
 	guiPort := scaleConfig.RestAPI[0].GuiPort
 	if guiPort == 0 {
 		guiPort = settings.DefaultGuiPort
 	}
 
-	var tr *http.Transport
 	endpoint := fmt.Sprintf("%s://%s:%d/", settings.GuiProtocol, guiHost, guiPort)
 
+	httpClient, err := newHTTPClient(scaleConfig)
+	if err != nil {
+		return &spectrumRestV2{}, err
+	}
+
+	return &spectrumRestV2{
+		httpClient: httpClient,
+		endpoint:   endpoint,
+		user:       scaleConfig.MgmtUsername,
+		password:   scaleConfig.MgmtPassword,
+	}, nil
+}
+
+func newHTTPClient(scaleConfig settings.Clusters) (*http.Client, error) {
+	guiHost := scaleConfig.RestAPI[0].GuiHost
+
+	var tr *http.Transport
 	if scaleConfig.SecureSslMode {
 		caCertPool := x509.NewCertPool()
 		if ok := caCertPool.AppendCertsFromPEM(scaleConfig.CacertValue); !ok {
-			return &spectrumRestV2{}, fmt.Errorf("Parsing CA cert %v failed", scaleConfig.Cacert)
+			return nil, fmt.Errorf("Parsing CA cert %v failed", scaleConfig.Cacert)
 		}
 		tr = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: caCertPool}}
 		glog.V(4).Infof("Created Spectrum Scale connector with SSL mode for %v", guiHost)
@@ -139,17 +169,30 @@ func NewSpectrumRestV2(scaleConfig settings.Clusters) (SpectrumScaleConnector, e
 		glog.V(4).Infof("Created Spectrum Scale connector without SSL mode for %v", guiHost)
 	}
 
-	return &spectrumRestV2{
-		httpClient: &http.Client{
-			Transport: tr,
-			Timeout:   time.Second * 10,
-		},
-		endpoint: endpoint,
-		user:     guiUser,
-		password: guiPwd,
+	return &http.Client{
+		Transport: tr,
+		Timeout:   time.Second * 10,
 	}, nil
 }
 
+// UpdateCredentials replaces the GUI credentials and the CA certificate used
+// by the connector.
+func (s *spectrumRestV2) UpdateCredentials(scaleConfig settings.Clusters) error {
+	glog.V(4).Infof("rest_v2 UpdateCredentials. cluster: %s", scaleConfig.ID)
+
+	httpClient, err := newHTTPClient(scaleConfig)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.httpClient = httpClient
+	s.user = scaleConfig.MgmtUsername
+	s.password = scaleConfig.MgmtPassword
+	return nil
+}
+
 func (s *spectrumRestV2) GetClusterId() (string, error) {
 	glog.V(4).Infof("rest_v2 GetClusterId")
 
@@ -165,6 +208,59 @@ func (s *spectrumRestV2) GetClusterId() (string, error) {
 	return cid_str, nil
 }
 
+func (s *spectrumRestV2) GetCesSummary() (CesSummary, error) {
+	glog.V(4).Infof("rest_v2 GetCesSummary")
+
+	getClusterURL := utils.FormatURL(s.endpoint, "scalemgmt/v2/cluster")
+	getClusterResponse := GetClusterResponse{}
+
+	err := s.doHTTP(getClusterURL, "GET", &getClusterResponse, nil)
+	if err != nil {
+		glog.Errorf("Unable to get CES summary: %v", err)
+		return CesSummary{}, err
+	}
+	return getClusterResponse.Cluster.CesSummary, nil
+}
+
+func (s *spectrumRestV2) ListNodes() ([]Node_v2, error) {
+	glog.V(4).Infof("rest_v2 ListNodes")
+
+	nodes := []Node_v2{}
+	listNodesURL := utils.FormatURL(s.endpoint, "scalemgmt/v2/nodes?fields=:all:")
+	for listNodesURL != "" {
+		listNodesResponse := GetNodesResponse_v2{}
+		err := s.doHTTP(listNodesURL, "GET", &listNodesResponse, nil)
+		if err != nil {
+			glog.Errorf("Unable to list nodes: %v", err)
+			return nil, err
+		}
+		nodes = append(nodes, listNodesResponse.Nodes...)
+		listNodesURL = listNodesResponse.Paging.Next
+	}
+	return nodes, nil
+}
+
+func (s *spectrumRestV2) GetNode(nodeName string) (Node_v2, error) {
+	glog.V(4).Infof("rest_v2 GetNode. nodeName: %s", nodeName)
+
+	getNodeURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/nodes/%s?fields=:all:", url.PathEscape(nodeName)))
+	getNodeResponse := GetNodesResponse_v2{}
+
+	err := s.doHTTP(getNodeURL, "GET", &getNodeResponse, nil)
+	if err != nil {
+		if isNotFound(getNodeResponse.Status) {
+			return Node_v2{}, status.Error(codes.NotFound, fmt.Sprintf("Node %s not found: %v", nodeName, getNodeResponse.Status.Message))
+		}
+		glog.Errorf("Unable to get node %s: %v", nodeName, err)
+		return Node_v2{}, err
+	}
+
+	if len(getNodeResponse.Nodes) == 0 {
+		return Node_v2{}, status.Error(codes.NotFound, fmt.Sprintf("Node %s not found", nodeName))
+	}
+	return getNodeResponse.Nodes[0], nil
+}
+
 func (s *spectrumRestV2) GetFilesystemMountDetails(filesystemName string) (MountInfo, error) {
 	glog.V(4).Infof("rest_v2 GetFilesystemMountDetails. filesystemName: %s", filesystemName)
 
@@ -235,12 +331,98 @@ func (s *spectrumRestV2) GetFilesystemMountpoint(filesystemName string) (string,
 	}
 }
 
+func (s *spectrumRestV2) ListStoragePools(filesystemName string) ([]string, error) {
+	glog.V(4).Infof("rest_v2 ListStoragePools. filesystem: %s", filesystemName)
+
+	pools := []string{}
+	listPoolsURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/pools", filesystemName))
+	for listPoolsURL != "" {
+		listPoolsResponse := GetStoragePoolsResponse_v2{}
+		err := s.doHTTP(listPoolsURL, "GET", &listPoolsResponse, nil)
+		if err != nil {
+			glog.Errorf("Unable to list storage pools of filesystem %s: %v", filesystemName, err)
+			return nil, err
+		}
+		for _, pool := range listPoolsResponse.StoragePools {
+			pools = append(pools, pool.StoragePoolName)
+		}
+		listPoolsURL = listPoolsResponse.Paging.Next
+	}
+	return pools, nil
+}
+
+func (s *spectrumRestV2) IsFilesystemEncryptionEnabled(filesystemName string) (bool, error) {
+	glog.V(4).Infof("rest_v2 IsFilesystemEncryptionEnabled. filesystem: %s", filesystemName)
+
+	getFilesystemURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s?fields=:all:", filesystemName))
+	getFilesystemResponse := GetFilesystemResponse_v2{}
+
+	err := s.doHTTP(getFilesystemURL, "GET", &getFilesystemResponse, nil)
+	if err != nil {
+		glog.Errorf("Unable to get filesystem details for %s: %v", filesystemName, err)
+		return false, err
+	}
+
+	if len(getFilesystemResponse.FileSystems) == 0 {
+		return false, fmt.Errorf("Unable to fetch settings of filesystem %s", filesystemName)
+	}
+	return getFilesystemResponse.FileSystems[0].Settings.Encryption, nil
+}
+
+func (s *spectrumRestV2) GetFilesystemPolicy(filesystemName string) (string, error) {
+	glog.V(4).Infof("rest_v2 GetFilesystemPolicy. filesystem: %s", filesystemName)
+
+	getPolicyURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/policies", filesystemName))
+	getPolicyResponse := GetPolicyResponse_v2{}
+
+	err := s.doHTTP(getPolicyURL, "GET", &getPolicyResponse, nil)
+	if err != nil {
+		glog.Errorf("Unable to get policy of filesystem %s: %v", filesystemName, err)
+		return "", err
+	}
+
+	if len(getPolicyResponse.Policies) == 0 {
+		return "", nil
+	}
+	return getPolicyResponse.Policies[0].Policy, nil
+}
+
+func (s *spectrumRestV2) SetFilesystemPolicy(filesystemName string, policy string) error {
+	glog.V(4).Infof("rest_v2 SetFilesystemPolicy. filesystem: %s", filesystemName)
+
+	setPolicyURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/policies", filesystemName))
+	setPolicyRequest := SetPolicyRequest_v2{Policy: policy}
+	setPolicyResponse := GenericResponse{}
+
+	err := s.doHTTP(setPolicyURL, "PUT", &setPolicyResponse, setPolicyRequest)
+	if err != nil {
+		glog.Errorf("Error in set policy request: %v", err)
+		return err
+	}
+
+	err = s.isRequestAccepted(setPolicyResponse, setPolicyURL)
+	if err != nil {
+		glog.Errorf("Request not accepted for processing: %v", err)
+		return err
+	}
+
+	err = s.waitForJobCompletion(setPolicyResponse.Status.Code, setPolicyResponse.Jobs[0].JobID)
+	if err != nil {
+		glog.Errorf("Unable to set policy of filesystem %s: %v", filesystemName, err)
+		return err
+	}
+	return nil
+}
+
 func (s *spectrumRestV2) CreateFileset(filesystemName string, filesetName string, opts map[string]interface{}) error {
 	glog.V(4).Infof("rest_v2 CreateFileset. filesystem: %s, fileset: %s, opts: %v", filesystemName, filesetName, opts)
 
 	filesetreq := CreateFilesetRequest{}
 	filesetreq.FilesetName = filesetName
 	filesetreq.Comment = "Fileset created by IBM Container Storage Interface driver"
+	if comment, commentSpecified := opts[FilesetComment]; commentSpecified {
+		filesetreq.Comment = comment.(string)
+	}
 
 	filesetType, filesetTypeSpecified := opts[UserSpecifiedFilesetType]
 	inodeLimit, inodeLimitSpecified := opts[UserSpecifiedInodeLimit]
@@ -269,6 +451,28 @@ func (s *spectrumRestV2) CreateFileset(filesystemName string, filesetName string
 		}
 	}
 
+	if afmMode, afmModeSpecified := opts[UserSpecifiedAfmMode]; afmModeSpecified {
+		/* AFM cache filesets are always independent filesets */
+		filesetreq.InodeSpace = "new"
+		filesetreq.AfmMode = afmMode.(string)
+		filesetreq.AfmTarget = opts[UserSpecifiedAfmTarget].(string)
+		if asyncDelay, asyncDelaySpecified := opts[UserSpecifiedAfmAsyncDelay]; asyncDelaySpecified {
+			filesetreq.AfmAsyncDelay = asyncDelay.(string)
+		}
+	}
+
+	if iamMode, iamModeSpecified := opts[UserSpecifiedIamMode]; iamModeSpecified {
+		filesetreq.IamMode = iamMode.(string)
+	}
+
+	if permChangeMode, permChangeModeSpecified := opts[UserSpecifiedPermChangeMode]; permChangeModeSpecified {
+		filesetreq.PermissionChangeMode = permChangeMode.(string)
+	}
+
+	if permissions, permissionsSpecified := opts[UserSpecifiedPermissions]; permissionsSpecified {
+		filesetreq.Permissions = permissions.(string)
+	}
+
 	uid, uidSpecified := opts[UserSpecifiedUID]
 	gid, gidSpecified := opts[UserSpecifiedGID]
 
@@ -401,18 +605,68 @@ func (s *spectrumRestV2) ListFileset(filesystemName string, filesetName string)
 
 	err := s.doHTTP(getFilesetURL, "GET", &getFilesetResponse, nil)
 	if err != nil {
+		/* The GUI reports unknown filesets as invalid fileset name */
+		if isNotFound(getFilesetResponse.Status) ||
+			(getFilesetResponse.Status.Code == http.StatusBadRequest && strings.Contains(getFilesetResponse.Status.Message, "Invalid value in 'filesetName'")) {
+			return Fileset_v2{}, status.Error(codes.NotFound, fmt.Sprintf("Fileset %s not found: %v", filesetName, getFilesetResponse.Status.Message))
+		}
 		glog.Errorf("Error in list fileset request: %v", err)
 		return Fileset_v2{}, err
 	}
 
 	if len(getFilesetResponse.Filesets) == 0 {
 		glog.Errorf("No fileset returned for %s", filesetName)
-		return Fileset_v2{}, fmt.Errorf("No fileset returned for %s", filesetName)
+		return Fileset_v2{}, status.Error(codes.NotFound, fmt.Sprintf("No fileset returned for %s", filesetName))
 	}
 
 	return getFilesetResponse.Filesets[0], nil
 }
 
+func (s *spectrumRestV2) ListFilesets(filesystemName string) ([]Fileset_v2, error) {
+	glog.V(4).Infof("rest_v2 ListFilesets. filesystem: %s", filesystemName)
+
+	filesets := []Fileset_v2{}
+	listFilesetsURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/filesets?fields=:all:", filesystemName))
+	for listFilesetsURL != "" {
+		listFilesetsResponse := GetFilesetResponse_v2{}
+		err := s.doHTTP(listFilesetsURL, "GET", &listFilesetsResponse, nil)
+		if err != nil {
+			glog.Errorf("Unable to list filesets of %s: %v", filesystemName, err)
+			return nil, err
+		}
+		filesets = append(filesets, listFilesetsResponse.Filesets...)
+		listFilesetsURL = listFilesetsResponse.Paging.Next
+	}
+	return filesets, nil
+}
+
+func (s *spectrumRestV2) SetFilesetInodeLimit(filesystemName string, filesetName string, maxNumInodes string) error {
+	glog.V(4).Infof("rest_v2 SetFilesetInodeLimit. filesystem: %s, fileset: %s, maxNumInodes: %s", filesystemName, filesetName, maxNumInodes)
+
+	updatereq := UpdateFilesetRequest{MaxNumInodes: maxNumInodes}
+	updateFilesetURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/filesets/%s", filesystemName, filesetName))
+	updateFilesetResponse := GenericResponse{}
+
+	err := s.doHTTP(updateFilesetURL, "PUT", &updateFilesetResponse, updatereq)
+	if err != nil {
+		glog.Errorf("Error in update fileset request: %v", err)
+		return err
+	}
+
+	err = s.isRequestAccepted(updateFilesetResponse, updateFilesetURL)
+	if err != nil {
+		glog.Errorf("Request not accepted for processing: %v", err)
+		return err
+	}
+
+	err = s.waitForJobCompletion(updateFilesetResponse.Status.Code, updateFilesetResponse.Jobs[0].JobID)
+	if err != nil {
+		glog.Errorf("Unable to set inode limit of fileset %s: %v", filesetName, err)
+		return err
+	}
+	return nil
+}
+
 func (s *spectrumRestV2) IsFilesetLinked(filesystemName string, filesetName string) (bool, error) {
 	glog.V(4).Infof("rest_v2 IsFilesetLinked. filesystem: %s, fileset: %s", filesystemName, filesetName)
 
@@ -428,10 +682,11 @@ func (s *spectrumRestV2) IsFilesetLinked(filesystemName string, filesetName stri
 	return true, nil
 }
 
-func (s *spectrumRestV2) MakeDirectory(filesystemName string, relativePath string, uid string, gid string) error {
-	glog.V(4).Infof("rest_v2 MakeDirectory. filesystem: %s, path: %s, uid: %s, gid: %s", filesystemName, relativePath, uid, gid)
+func (s *spectrumRestV2) MakeDirectory(filesystemName string, relativePath string, uid string, gid string, permissions string) error {
+	glog.V(4).Infof("rest_v2 MakeDirectory. filesystem: %s, path: %s, uid: %s, gid: %s, permissions: %s", filesystemName, relativePath, uid, gid, permissions)
 
 	dirreq := CreateMakeDirRequest{}
+	dirreq.PERMISSIONS = permissions
 
 	if uid != "" {
 		_, err := strconv.Atoi(uid)
@@ -486,14 +741,57 @@ func (s *spectrumRestV2) MakeDirectory(filesystemName string, relativePath strin
 	return nil
 }
 
-func (s *spectrumRestV2) SetFilesetQuota(filesystemName string, filesetName string, quota string) error {
-	glog.V(4).Infof("rest_v2 SetFilesetQuota. filesystem: %s, fileset: %s, quota: %s", filesystemName, filesetName, quota)
+func (s *spectrumRestV2) SetNFSv4ACL(filesystemName string, relativePath string, entries []ACLEntry) error {
+	glog.V(4).Infof("rest_v2 SetNFSv4ACL. filesystem: %s, path: %s, entries: %v", filesystemName, relativePath, entries)
+
+	aclreq := SetACLRequest{Type: "NFSv4", Entries: entries}
+
+	formattedPath := strings.ReplaceAll(relativePath, "/", "%2F")
+	setACLURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/acl/%s", filesystemName, formattedPath))
+	setACLResponse := GenericResponse{}
+
+	err := s.doHTTP(setACLURL, "PUT", &setACLResponse, aclreq)
+	if err != nil {
+		glog.Errorf("Error in set ACL request: %v", err)
+		return err
+	}
+
+	err = s.isRequestAccepted(setACLResponse, setACLURL)
+	if err != nil {
+		glog.Errorf("Request not accepted for processing: %v", err)
+		return err
+	}
+
+	err = s.waitForJobCompletion(setACLResponse.Status.Code, setACLResponse.Jobs[0].JobID)
+	if err != nil {
+		glog.Errorf("Unable to set ACL of %s: %v", relativePath, err)
+		return err
+	}
+	return nil
+}
+
+func (s *spectrumRestV2) SetFilesetQuota(filesystemName string, filesetName string, quota string, opts map[string]interface{}) error { //nolint:funlen
+	glog.V(4).Infof("rest_v2 SetFilesetQuota. filesystem: %s, fileset: %s, quota: %s, opts: %v", filesystemName, filesetName, quota, opts)
 
 	setQuotaURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/quotas", filesystemName))
 	quotaRequest := SetQuotaRequest_v2{}
 
-	quotaRequest.BlockHardLimit = quota
-	quotaRequest.BlockSoftLimit = quota
+	if quota != "" {
+		quotaRequest.BlockHardLimit = quota
+		quotaRequest.BlockSoftLimit = quota
+	}
+	softLimit, softLimitSpecified := opts[QuotaBlockSoftLimit]
+	if softLimitSpecified {
+		quotaRequest.BlockSoftLimit = fmt.Sprintf("%v", softLimit)
+	}
+	filesHardLimit, filesHardLimitSpecified := opts[UserSpecifiedFilesHardLimit]
+	if filesHardLimitSpecified {
+		quotaRequest.FilesHardLimit = fmt.Sprintf("%v", filesHardLimit)
+	}
+	filesSoftLimit, filesSoftLimitSpecified := opts[UserSpecifiedFilesSoftLimit]
+	if filesSoftLimitSpecified {
+		quotaRequest.FilesSoftLimit = fmt.Sprintf("%v", filesSoftLimit)
+	}
 	quotaRequest.OperationType = "setQuota"
 	quotaRequest.QuotaType = "fileset"
 	quotaRequest.ObjectName = filesetName
@@ -517,6 +815,43 @@ func (s *spectrumRestV2) SetFilesetQuota(filesystemName string, filesetName stri
 		glog.Errorf("Unable to set quota for fileset %s: %v", filesetName, err)
 		return err
 	}
+
+	blockGracePeriod, blockGraceSpecified := opts[UserSpecifiedBlockGracePeriod]
+	filesGracePeriod, filesGraceSpecified := opts[UserSpecifiedFilesGracePeriod]
+	if !blockGraceSpecified && !filesGraceSpecified {
+		return nil
+	}
+
+	/* Grace periods apply to all fileset quotas of the filesystem */
+	graceRequest := SetQuotaRequest_v2{}
+	if blockGraceSpecified {
+		graceRequest.BlockGracePeriod = fmt.Sprintf("%v", blockGracePeriod)
+	}
+	if filesGraceSpecified {
+		graceRequest.FilesGracePeriod = fmt.Sprintf("%v", filesGracePeriod)
+	}
+	graceRequest.OperationType = "setGracePeriod"
+	graceRequest.QuotaType = "fileset"
+
+	setGraceResponse := GenericResponse{}
+
+	err = s.doHTTP(setQuotaURL, "POST", &setGraceResponse, graceRequest)
+	if err != nil {
+		glog.Errorf("Error in set fileset quota grace period request: %v", err)
+		return err
+	}
+
+	err = s.isRequestAccepted(setGraceResponse, setQuotaURL)
+	if err != nil {
+		glog.Errorf("Request not accepted for processing: %v", err)
+		return err
+	}
+
+	err = s.waitForJobCompletion(setGraceResponse.Status.Code, setGraceResponse.Jobs[0].JobID)
+	if err != nil {
+		glog.Errorf("Unable to set quota grace period for filesystem %s: %v", filesystemName, err)
+		return err
+	}
 	return nil
 }
 
@@ -555,10 +890,34 @@ func (s *spectrumRestV2) ListFilesetQuota(filesystemName string, filesetName str
 	}
 }
 
+func (s *spectrumRestV2) GetFilesetQuotaDetails(filesystemName string, filesetName string) (Quota_v2, error) {
+	glog.V(4).Infof("rest_v2 GetFilesetQuotaDetails. filesystem: %s, fileset: %s", filesystemName, filesetName)
+
+	listQuotaURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/quotas?filter=objectName=%s", filesystemName, filesetName))
+	listQuotaResponse := GetQuotaResponse_v2{}
+
+	err := s.doHTTP(listQuotaURL, "GET", &listQuotaResponse, nil)
+	if err != nil {
+		glog.Errorf("Unable to fetch quota information: %v", err)
+		return Quota_v2{}, err
+	}
+
+	for _, quota := range listQuotaResponse.Quotas {
+		if strings.EqualFold(quota.QuotaType, "fileset") {
+			return quota, nil
+		}
+	}
+	return Quota_v2{}, fmt.Errorf("No quota information found for fileset %s", filesetName)
+}
+
 func (s *spectrumRestV2) doHTTP(endpoint string, method string, responseObject interface{}, param interface{}) error {
 	glog.V(4).Infof("rest_v2 doHTTP. endpoint: %s, method: %s, param: %v", endpoint, method, param)
 
-	response, err := utils.HttpExecuteUserAuth(s.httpClient, method, endpoint, s.user, s.password, param)
+	s.mux.RLock()
+	httpClient, user, password := s.httpClient, s.user, s.password
+	s.mux.RUnlock()
+
+	response, err := utils.HttpExecuteUserAuth(httpClient, method, endpoint, user, password, param)
 	if err != nil {
 		glog.Errorf("Error in authentication request: %v", err)
 		return err
@@ -581,11 +940,12 @@ func (s *spectrumRestV2) doHTTP(endpoint string, method string, responseObject i
 	return nil
 }
 
-func (s *spectrumRestV2) MountFilesystem(filesystemName string, nodeName string) error { //nolint:dupl
-	glog.V(4).Infof("rest_v2 MountFilesystem. filesystem: %s, node: %s", filesystemName, nodeName)
+func (s *spectrumRestV2) MountFilesystem(filesystemName string, nodeName string, mountOptions string) error { //nolint:dupl
+	glog.V(4).Infof("rest_v2 MountFilesystem. filesystem: %s, node: %s, mountOptions: %s", filesystemName, nodeName, mountOptions)
 
 	mountreq := MountFilesystemRequest{}
 	mountreq.Nodes = append(mountreq.Nodes, nodeName)
+	mountreq.MountOptions = mountOptions
 
 	mountFilesystemURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/mount", filesystemName))
 	mountFilesystemResponse := GenericResponse{}
@@ -703,6 +1063,36 @@ func (s *spectrumRestV2) DeleteSymLnk(filesystemName string, LnkName string) err
 	return nil
 }
 
+// CopyDirectory copies the content of a directory to a directory of the same
+// or another filesystem of the cluster.
+func (s *spectrumRestV2) CopyDirectory(filesystemName string, relativePath string, targetFs string, targetPath string) error {
+	glog.V(4).Infof("rest_v2 CopyDirectory. filesystem: %s, path: %s, target filesystem: %s, target path: %s", filesystemName, relativePath, targetFs, targetPath)
+
+	copyreq := CopyPathRequest{TargetFilesystem: targetFs, TargetPath: targetPath}
+	formattedPath := strings.ReplaceAll(relativePath, "/", "%2F")
+	copyDirURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/directoryCopy/%s", filesystemName, formattedPath))
+	copyDirResponse := GenericResponse{}
+
+	err := s.doHTTP(copyDirURL, "PUT", &copyDirResponse, copyreq)
+	if err != nil {
+		glog.Errorf("Error in copy directory request: %v", err)
+		return err
+	}
+
+	err = s.isRequestAccepted(copyDirResponse, copyDirURL)
+	if err != nil {
+		glog.Errorf("Request not accepted for processing: %v", err)
+		return err
+	}
+
+	err = s.waitForJobCompletion(copyDirResponse.Status.Code, copyDirResponse.Jobs[0].JobID)
+	if err != nil {
+		glog.Errorf("Unable to copy directory %s of FS %s to %s of FS %s: %v", relativePath, filesystemName, targetPath, targetFs, err)
+		return err
+	}
+	return nil
+}
+
 func (s *spectrumRestV2) DeleteDirectory(filesystemName string, dirName string) error {
 	NdirName := strings.ReplaceAll(dirName, "/", "%2F")
 	deleteDirURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/directory/%s", filesystemName, NdirName))
@@ -710,7 +1100,7 @@ func (s *spectrumRestV2) DeleteDirectory(filesystemName string, dirName string)
 
 	err := s.doHTTP(deleteDirURL, "DELETE", &deleteDirResponse, nil)
 	if err != nil {
-		return fmt.Errorf("Unable to delete dir %v.", dirName)
+		return fmt.Errorf("Unable to delete dir %v: %v %v", dirName, err, deleteDirResponse.Status.Message)
 	}
 
 	err = s.isRequestAccepted(deleteDirResponse, deleteDirURL)
@@ -802,3 +1192,172 @@ func (s *spectrumRestV2) CreateSymLink(SlnkfilesystemName string, TargetFs strin
 	}
 	return err
 }
+
+func (s *spectrumRestV2) IsNfsExported(exportPath string) (bool, error) {
+	glog.V(4).Infof("rest_v2 IsNfsExported. path: %s", exportPath)
+
+	formattedPath := strings.ReplaceAll(exportPath, "/", "%2F")
+	getExportURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/nfs/exports/%s", formattedPath))
+	getExportResponse := GetNfsExportResponse{}
+
+	err := s.doHTTP(getExportURL, "GET", &getExportResponse, nil)
+	if err != nil {
+		if isNotFound(getExportResponse.Status) {
+			return false, nil
+		}
+		glog.Errorf("Unable to get NFS export %s: %v", exportPath, err)
+		return false, err
+	}
+	return len(getExportResponse.Exports) > 0, nil
+}
+
+func (s *spectrumRestV2) ListNfsExports(filesystemName string) ([]NfsExport, error) {
+	glog.V(4).Infof("rest_v2 ListNfsExports. filesystem: %s", filesystemName)
+
+	exports := []NfsExport{}
+	listExportsURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/nfs/exports?filter=filesystemName=%s", filesystemName))
+	for listExportsURL != "" {
+		listExportsResponse := GetNfsExportResponse{}
+		err := s.doHTTP(listExportsURL, "GET", &listExportsResponse, nil)
+		if err != nil {
+			glog.Errorf("Unable to list NFS exports of %s: %v", filesystemName, err)
+			return nil, err
+		}
+		exports = append(exports, listExportsResponse.Exports...)
+		listExportsURL = listExportsResponse.Paging.Next
+	}
+	return exports, nil
+}
+
+func (s *spectrumRestV2) CreateNfsExport(exportPath string, clients []string) error {
+	glog.V(4).Infof("rest_v2 CreateNfsExport. path: %s, clients: %v", exportPath, clients)
+
+	exportreq := NfsExportRequest{Path: exportPath, ClientDetail: clients}
+	createExportURL := utils.FormatURL(s.endpoint, "scalemgmt/v2/nfs/exports")
+	createExportResponse := GenericResponse{}
+
+	err := s.doHTTP(createExportURL, "POST", &createExportResponse, exportreq)
+	if err != nil {
+		glog.Errorf("Error in create NFS export request: %v", err)
+		return err
+	}
+
+	err = s.isRequestAccepted(createExportResponse, createExportURL)
+	if err != nil {
+		glog.Errorf("Request not accepted for processing: %v", err)
+		return err
+	}
+
+	err = s.waitForJobCompletion(createExportResponse.Status.Code, createExportResponse.Jobs[0].JobID)
+	if err != nil {
+		glog.Errorf("Unable to create NFS export %s: %v", exportPath, err)
+		return err
+	}
+	return nil
+}
+
+func (s *spectrumRestV2) DeleteNfsExport(exportPath string) error {
+	glog.V(4).Infof("rest_v2 DeleteNfsExport. path: %s", exportPath)
+
+	formattedPath := strings.ReplaceAll(exportPath, "/", "%2F")
+	deleteExportURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/nfs/exports/%s", formattedPath))
+	deleteExportResponse := GenericResponse{}
+
+	err := s.doHTTP(deleteExportURL, "DELETE", &deleteExportResponse, nil)
+	if err != nil {
+		if isNotFound(deleteExportResponse.Status) {
+			glog.Infof("NFS export %s would have been deleted. So returning success %v", exportPath, err)
+			return nil
+		}
+		glog.Errorf("Error in delete NFS export request: %v", err)
+		return err
+	}
+
+	err = s.isRequestAccepted(deleteExportResponse, deleteExportURL)
+	if err != nil {
+		glog.Errorf("Request not accepted for processing: %v", err)
+		return err
+	}
+
+	err = s.waitForJobCompletion(deleteExportResponse.Status.Code, deleteExportResponse.Jobs[0].JobID)
+	if err != nil {
+		glog.Errorf("Unable to delete NFS export %s: %v", exportPath, err)
+		return err
+	}
+	return nil
+}
+
+func (s *spectrumRestV2) ListFilesetSnapshots(filesystemName string, filesetName string) ([]Snapshot_v2, error) {
+	glog.V(4).Infof("rest_v2 ListFilesetSnapshots. filesystem: %s, fileset: %s", filesystemName, filesetName)
+
+	snapshots := []Snapshot_v2{}
+	listSnapshotsURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/filesets/%s/snapshots", filesystemName, filesetName))
+	for listSnapshotsURL != "" {
+		listSnapshotsResponse := GetSnapshotResponse_v2{}
+		err := s.doHTTP(listSnapshotsURL, "GET", &listSnapshotsResponse, nil)
+		if err != nil {
+			glog.Errorf("Unable to list snapshots of fileset %s: %v", filesetName, err)
+			return nil, err
+		}
+		snapshots = append(snapshots, listSnapshotsResponse.Snapshots...)
+		listSnapshotsURL = listSnapshotsResponse.Paging.Next
+	}
+	return snapshots, nil
+}
+
+func (s *spectrumRestV2) CreateFilesetSnapshot(filesystemName string, filesetName string, snapshotName string) error {
+	glog.V(4).Infof("rest_v2 CreateFilesetSnapshot. filesystem: %s, fileset: %s, snapshot: %s", filesystemName, filesetName, snapshotName)
+
+	snapshotreq := CreateSnapshotRequest{SnapshotName: snapshotName}
+	createSnapshotURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/filesets/%s/snapshots", filesystemName, filesetName))
+	createSnapshotResponse := GenericResponse{}
+
+	err := s.doHTTP(createSnapshotURL, "POST", &createSnapshotResponse, snapshotreq)
+	if err != nil {
+		glog.Errorf("Error in create snapshot request: %v", err)
+		return err
+	}
+
+	err = s.isRequestAccepted(createSnapshotResponse, createSnapshotURL)
+	if err != nil {
+		glog.Errorf("Request not accepted for processing: %v", err)
+		return err
+	}
+
+	err = s.waitForJobCompletion(createSnapshotResponse.Status.Code, createSnapshotResponse.Jobs[0].JobID)
+	if err != nil {
+		glog.Errorf("Unable to create snapshot %s of fileset %s: %v", snapshotName, filesetName, err)
+		return err
+	}
+	return nil
+}
+
+func (s *spectrumRestV2) DeleteFilesetSnapshot(filesystemName string, filesetName string, snapshotName string) error {
+	glog.V(4).Infof("rest_v2 DeleteFilesetSnapshot. filesystem: %s, fileset: %s, snapshot: %s", filesystemName, filesetName, snapshotName)
+
+	deleteSnapshotURL := utils.FormatURL(s.endpoint, fmt.Sprintf("scalemgmt/v2/filesystems/%s/filesets/%s/snapshots/%s", filesystemName, filesetName, snapshotName))
+	deleteSnapshotResponse := GenericResponse{}
+
+	err := s.doHTTP(deleteSnapshotURL, "DELETE", &deleteSnapshotResponse, nil)
+	if err != nil {
+		if isNotFound(deleteSnapshotResponse.Status) {
+			glog.Infof("Snapshot %s would have been deleted. So returning success %v", snapshotName, err)
+			return nil
+		}
+		glog.Errorf("Error in delete snapshot request: %v", err)
+		return err
+	}
+
+	err = s.isRequestAccepted(deleteSnapshotResponse, deleteSnapshotURL)
+	if err != nil {
+		glog.Errorf("Request not accepted for processing: %v", err)
+		return err
+	}
+
+	err = s.waitForJobCompletion(deleteSnapshotResponse.Status.Code, deleteSnapshotResponse.Jobs[0].JobID)
+	if err != nil {
+		glog.Errorf("Unable to delete snapshot %s of fileset %s: %v", snapshotName, filesetName, err)
+		return err
+	}
+	return nil
+}
@@ -18,23 +18,28 @@ package scale
 
 import (
 	"fmt"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/connectors"
 	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/utils"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/volumeid"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/ptypes"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 const (
-	no       = "no"
-	yes      = "yes"
-	notFound = "NOT_FOUND"
+	no  = "no"
+	yes = "yes"
+
+	gpfsStateActive = "ACTIVE"
 )
 
 type ScaleControllerServer struct {
@@ -54,36 +59,47 @@ func (cs *ScaleControllerServer) IfSameVolReqInProcess(scVol *scaleVolume) (bool
 	return false, nil
 }
 
-func (cs *ScaleControllerServer) GetPriConnAndSLnkPath() (connectors.SpectrumScaleConnector, string, string, string, string, string, error) {
-	primaryConn, isprimaryConnPresent := cs.Driver.connmap["primary"]
+func (cs *ScaleControllerServer) GetPriConnAndSLnkPath(primaryName string) (connectors.SpectrumScaleConnector, string, string, string, string, string, error) {
+	primary, primaryConn, err := cs.Driver.GetPrimary(primaryName)
 
-	if isprimaryConnPresent {
-		return primaryConn, cs.Driver.primary.SymlinkRelativePath, cs.Driver.primary.GetPrimaryFs(), cs.Driver.primary.PrimaryFSMount, cs.Driver.primary.SymlinkAbsolutePath, cs.Driver.primary.PrimaryCid, nil
+	if err == nil {
+		return primaryConn, primary.SymlinkRelativePath, primary.GetPrimaryFs(), primary.PrimaryFSMount, primary.SymlinkAbsolutePath, primary.PrimaryCid, nil
 	}
 
-	return nil, "", "", "", "", "", status.Error(codes.Internal, "Primary connector not present in configMap")
+	return nil, "", "", "", "", "", status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid primaryName [%v]. Error [%v]", primaryName, err))
 }
 
 func (cs *ScaleControllerServer) IfFileSetBasedVolExist(scVol *scaleVolume) (bool, error) {
-	/* Check if fileset is there. Check if quota matches and see if symlink exists*/
-	_, err := scVol.Connector.ListFileset(scVol.VolBackendFs, scVol.VolName)
+	/* Check if fileset is there. Check if quota and AFM settings match and see if symlink exists*/
+	fset, err := scVol.Connector.ListFileset(scVol.VolBackendFs, scVol.FilesetName)
 	if err != nil {
 		return false, nil
 	}
 
-	if scVol.VolSize != 0 {
-		quota, err := scVol.Connector.ListFilesetQuota(scVol.VolBackendFs, scVol.VolName)
+	err = checkFilesetAfm(scVol, fset)
+	if err != nil {
+		return false, err
+	}
+
+	err = checkFilesetIamMode(scVol, fset)
+	if err != nil {
+		return false, err
+	}
+
+	if scVol.needsQuota() {
+		quota, err := scVol.Connector.GetFilesetQuotaDetails(scVol.VolBackendFs, scVol.FilesetName)
 		if err != nil {
-			return false, status.Error(codes.Internal, fmt.Sprintf("Unable to list quota for Fset [%v] in FS [%v]. Error [%v]", scVol.VolName, scVol.VolBackendFs, err))
+			return false, status.Error(codes.Internal, fmt.Sprintf("Unable to list quota for Fset [%v] in FS [%v]. Error [%v]", scVol.FilesetName, scVol.VolBackendFs, err))
 		}
 
-		filesetQuotaBytes, err := ConvertToBytes(quota)
+		err = checkFilesetQuota(scVol, quota)
 		if err != nil {
 			return false, err
 		}
-		if filesetQuotaBytes != scVol.VolSize {
-			return false, status.Error(codes.AlreadyExists, fmt.Sprintf("Fileset %v present but quota %v does not match with requested size %v", scVol.VolName, filesetQuotaBytes, scVol.VolSize))
-		}
+	}
+
+	if scVol.isDirectPath() {
+		return true, nil
 	}
 
 	/* Check if Symlink Present */
@@ -100,6 +116,27 @@ func (cs *ScaleControllerServer) IfFileSetBasedVolExist(scVol *scaleVolume) (boo
 	return false, nil
 }
 
+// checkFilesetQuota verifies that the quota of an existing fileset matches the requested limits.
+func checkFilesetQuota(scVol *scaleVolume, quota connectors.Quota_v2) error {
+	if scVol.VolSize != 0 {
+		filesetQuotaBytes := uint64(quota.BlockLimit) * 1024
+		if filesetQuotaBytes != scVol.VolSize {
+			return status.Error(codes.AlreadyExists, fmt.Sprintf("Fileset %v present but quota %v does not match with requested size %v", scVol.VolName, filesetQuotaBytes, scVol.VolSize))
+		}
+		softLimit := getBlockSoftLimit(scVol.VolSize, scVol.BlockSoftLimitPc)
+		if !quotaMatches(quota.BlockQuota, softLimit) {
+			return status.Error(codes.AlreadyExists, fmt.Sprintf("Fileset %v present but block soft limit %vK does not match with requested soft limit %v", scVol.VolName, quota.BlockQuota, softLimit))
+		}
+	}
+	if scVol.FilesHardLimit != "" && strconv.Itoa(quota.FilesLimit) != scVol.FilesHardLimit {
+		return status.Error(codes.AlreadyExists, fmt.Sprintf("Fileset %v present but files hard limit %v does not match with requested limit %v", scVol.VolName, quota.FilesLimit, scVol.FilesHardLimit))
+	}
+	if scVol.FilesSoftLimit != "" && strconv.Itoa(quota.FilesQuota) != scVol.FilesSoftLimit {
+		return status.Error(codes.AlreadyExists, fmt.Sprintf("Fileset %v present but files soft limit %v does not match with requested limit %v", scVol.VolName, quota.FilesQuota, scVol.FilesSoftLimit))
+	}
+	return nil
+}
+
 func (cs *ScaleControllerServer) IfLwVolExist(scVol *scaleVolume) (bool, error) {
 	/* Check if Dir present and see if symlink exists*/
 	volPath := fmt.Sprintf("%s/%s", scVol.VolDirBasePath, scVol.VolName)
@@ -108,6 +145,10 @@ func (cs *ScaleControllerServer) IfLwVolExist(scVol *scaleVolume) (bool, error)
 		return false, status.Error(codes.Internal, fmt.Sprintf("Unable to check if path [%v] exists in FS [%v]. Error [%v]", volPath, scVol.VolBackendFs, err))
 	}
 
+	if dirPresent && scVol.isDirectPath() {
+		return true, nil
+	}
+
 	if dirPresent {
 		/* Check if Symlink Present */
 
@@ -142,17 +183,138 @@ func (cs *ScaleControllerServer) CreateLWVol(scVol *scaleVolume) error {
 
 	dirPath := fmt.Sprintf("%s/%s", scVol.VolDirBasePath, scVol.VolName)
 	/* FS from sc */
-	err = scVol.PrimaryConnector.MakeDirectory(scVol.VolBackendFs, dirPath, scVol.VolUid, scVol.VolGid)
+	err = scVol.PrimaryConnector.MakeDirectory(scVol.VolBackendFs, dirPath, scVol.VolUid, scVol.VolGid, scVol.Permissions)
 
 	if err != nil {
 		return status.Error(codes.Internal, fmt.Sprintf("Unable to create dir [%v] in FS [%v] with uid:gid [%v:%v]. Error [%v]", dirPath, scVol.VolBackendFs, scVol.VolUid, scVol.VolGid, err))
 	}
+
+	err = cs.SetVolumeACL(scVol, scVol.PrimaryConnector, dirPath)
+	if err != nil {
+		_ = scVol.PrimaryConnector.DeleteDirectory(scVol.VolBackendFs, dirPath)
+		return err
+	}
+	return nil
+}
+
+// ExportVolume creates a CES NFS export of the volume data in the cluster
+// owning the volume, unless it exists already. targetPath is the path of the
+// volume data relative to the mount point of the volume filesystem.
+func (cs *ScaleControllerServer) ExportVolume(scVol *scaleVolume, targetPath string) error {
+	cesSummary, err := scVol.Connector.GetCesSummary()
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to get CES services of cluster %v. Error [%v]", scVol.ClusterId, err))
+	}
+	nfsEnabled := false
+	for _, service := range strings.Split(cesSummary.EnabledServices, ",") {
+		if strings.EqualFold(strings.TrimSpace(service), cesServiceNfs) {
+			nfsEnabled = true
+		}
+	}
+	if !nfsEnabled {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("CES NFS service is not enabled in cluster %v, enabled services [%v]", scVol.ClusterId, cesSummary.EnabledServices))
+	}
+
+	nodes, err := scVol.Connector.ListNodes()
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to list nodes of cluster %v. Error [%v]", scVol.ClusterId, err))
+	}
+	cesAddress := ""
+	for _, node := range nodes {
+		for _, address := range strings.Split(node.CESInfo.CESIPList, ",") {
+			if address = strings.TrimSpace(address); address != "" && cesAddress == "" {
+				cesAddress = address
+			}
+		}
+	}
+	if cesAddress == "" {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("No CES address is assigned in cluster %v", scVol.ClusterId))
+	}
+
+	fsMountPoint, err := scVol.Connector.GetFilesystemMountpoint(scVol.VolBackendFs)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to get mount point of FS [%v] in cluster %v. Error [%v]", scVol.VolBackendFs, scVol.ClusterId, err))
+	}
+	exportPath := path.Join(fsMountPoint, targetPath)
+
+	exported, err := scVol.Connector.IsNfsExported(exportPath)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to check if [%v] is exported in cluster %v. Error [%v]", exportPath, scVol.ClusterId, err))
+	}
+	if !exported {
+		err = scVol.Connector.CreateNfsExport(exportPath, scVol.NfsClients)
+		if err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("Unable to create NFS export of [%v] in cluster %v. Error [%v]", exportPath, scVol.ClusterId, err))
+		}
+		glog.Infof("Created NFS export of [%v] for clients %v", exportPath, scVol.NfsClients)
+	}
+
+	scVol.NfsExportPath = exportPath
+	scVol.NfsExportLocation = fmt.Sprintf("%s:%s", cesAddress, exportPath)
+	return nil
+}
+
+// DeleteVolumeExport deletes the CES NFS export of a volume. The path of the
+// export is derived from the data path of the volume in the cluster owning it,
+// the link path of the fileset of fileset based volumes or the directory named
+// after the volume for directory based volumes. filesetName is empty for
+// directory based volumes.
+func (cs *ScaleControllerServer) DeleteVolumeExport(conn connectors.SpectrumScaleConnector, volumeIdMembers volumeid.VolumeID, filesystemName string, filesetName string, pvName string) error {
+	if !volumeIdMembers.NfsExport {
+		return nil
+	}
+
+	exportPath := volumeIdMembers.NfsExportPath
+	if exportPath == "" && filesetName != "" {
+		fset, err := conn.ListFileset(filesystemName, filesetName)
+		if err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+		}
+		/* The data of AFM cache volumes is the whole fileset */
+		exportPath = fset.Config.Path
+		if fset.AFM.AFMTarget == "" {
+			exportPath = path.Join(fset.Config.Path, pvName+"-data")
+		}
+	} else if exportPath == "" {
+		exports, err := conn.ListNfsExports(filesystemName)
+		if err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("Unable to list NFS exports of FS [%v] in clusterId [%v]. Error [%v]", filesystemName, volumeIdMembers.ClusterId, err))
+		}
+		for _, export := range exports {
+			if path.Base(export.Path) == pvName {
+				exportPath = export.Path
+			}
+		}
+		if exportPath == "" {
+			glog.Infof("No NFS export of volume [%v] found in FS [%v], it would have been deleted", pvName, filesystemName)
+			return nil
+		}
+	}
+
+	err := conn.DeleteNfsExport(exportPath)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to delete NFS export [%v] in clusterId [%v]. Error [%v]", exportPath, volumeIdMembers.ClusterId, err))
+	}
 	return nil
 }
 
-func (cs *ScaleControllerServer) GenerateVolId(scVol *scaleVolume) (string, error) {
-	var volId string
+// SetVolumeACL applies the NFSv4 ACL of the storageClass to the root directory
+// of a volume.
+func (cs *ScaleControllerServer) SetVolumeACL(scVol *scaleVolume, conn connectors.SpectrumScaleConnector, relPath string) error {
+	if len(scVol.NFSv4Acl) == 0 {
+		return nil
+	}
+	err := conn.SetNFSv4ACL(scVol.VolBackendFs, relPath, scVol.NFSv4Acl)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to set NFSv4 ACL of [%v] in FS [%v]. Error [%v]", relPath, scVol.VolBackendFs, err))
+	}
+	return nil
+}
 
+// GenerateVolId returns the ID of a volume. targetPath is the path of the
+// volume data relative to the mount point of the volume filesystem, it is
+// used as path of volumes in direct path mode.
+func (cs *ScaleControllerServer) GenerateVolId(scVol *scaleVolume, targetPath string) (string, error) {
 	/* We need to put FSUUID for localFS in volID */
 	uid, err := scVol.PrimaryConnector.GetFsUid(scVol.LocalFS)
 	glog.Infof("GetFsUID error [%v] uid [%v]", err, uid)
@@ -160,20 +322,39 @@ func (cs *ScaleControllerServer) GenerateVolId(scVol *scaleVolume) (string, erro
 		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to get FS UUID for FS [%v]. Error [%v]", scVol.VolBackendFs, err))
 	}
 
+	vIdMem := volumeid.VolumeID{
+		ClusterId:   scVol.ClusterId,
+		FsUUID:      uid,
+		FsName:      scVol.LocalFS,
+		VolType:     volumeid.TypeDirectory,
+		PathMode:    scVol.PathMode,
+		PrimaryName: scVol.PrimaryName,
+		NfsExport:   scVol.NfsExportPath != "",
+		SymLnkPath:  fmt.Sprintf("%s/%s", scVol.PrimarySLnkPath, scVol.VolName),
+	}
+
+	if scVol.isDirectPath() {
+		_, dataPath, err := cs.GetDataPath(scVol, targetPath)
+		if err != nil {
+			return "", err
+		}
+		vIdMem.SymLnkPath = dataPath
+	}
+
 	if scVol.IsFilesetBased {
-		fSetuid, err := scVol.Connector.GetFileSetUid(scVol.VolBackendFs, scVol.VolName)
+		fSetuid, err := scVol.Connector.GetFileSetUid(scVol.VolBackendFs, scVol.FilesetName)
 
 		if err != nil {
-			return "", status.Error(codes.Internal, fmt.Sprintf("Unable to get Fset UID for [%v] in FS [%v]. Error [%v]", scVol.VolName, scVol.VolBackendFs, err))
+			return "", status.Error(codes.Internal, fmt.Sprintf("Unable to get Fset UID for [%v] in FS [%v]. Error [%v]", scVol.FilesetName, scVol.VolBackendFs, err))
 		}
 
-		/* <cluster_id>;<filesystem_uuid>;fileset=<fileset_id>; path=<symlink_path> */
-		slink := fmt.Sprintf("%s/%s", scVol.PrimarySLnkPath, scVol.VolName)
-		volId = fmt.Sprintf("%s;%s;fileset=%s;path=%s", scVol.ClusterId, uid, fSetuid, slink)
-	} else {
-		/* <cluster_id>;<filesystem_uuid>;path=<symlink_path> */
-		slink := fmt.Sprintf("%s/%s", scVol.PrimarySLnkPath, scVol.VolName)
-		volId = fmt.Sprintf("%s;%s;path=%s", scVol.ClusterId, uid, slink)
+		vIdMem.VolType = volumeid.TypeFileset
+		vIdMem.FsetId = fSetuid
+	}
+
+	volId, err := volumeid.Encode(vIdMem)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to generate volume Id for [%v]. Error [%v]", scVol.VolName, err))
 	}
 	return volId, nil
 }
@@ -191,11 +372,41 @@ func (cs *ScaleControllerServer) GetFsMntPt(scVol *scaleVolume) (string, error)
 	return fsMountPt, err
 }
 
+// GetAccessibleTopology returns the topology from where the volume is accessible.
+// If the driver is not allowed to mount filesystems, the volume can only be used
+// on nodes where both the volume filesystem and the primary filesystem are mounted.
+// Volumes in direct path mode do not need the primary filesystem.
+func (cs *ScaleControllerServer) GetAccessibleTopology(scVol *scaleVolume, primaryCid string) ([]*csi.Topology, error) {
+	segments := map[string]string{topologyKeyCluster: primaryCid}
+
+	skipMountUnmount := utils.GetEnv("SKIP_MOUNT_UNMOUNT", yes)
+	if skipMountUnmount == yes {
+		fsNames := []string{scVol.LocalFS, scVol.PrimaryFS}
+		if scVol.isDirectPath() {
+			fsNames = []string{scVol.LocalFS}
+		}
+		for _, fsName := range fsNames {
+			mountInfo, err := scVol.PrimaryConnector.GetFilesystemMountDetails(fsName)
+			if err != nil {
+				return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to get Mount Details for FS [%v] in Primary cluster. Error [%v]", fsName, err))
+			}
+			if len(mountInfo.NodesMounted) == 0 {
+				return nil, status.Error(codes.ResourceExhausted, fmt.Sprintf("Filesystem %v is not mounted on any node in Primary cluster", fsName))
+			}
+			fsKey := getFsTopologyKey(fsName)
+			if fsKey != "" {
+				segments[fsKey] = topologyFsMounted
+			}
+		}
+	}
+
+	return []*csi.Topology{{Segments: segments}}, nil
+}
+
 func (cs *ScaleControllerServer) GetFsetLnkPath(scaleVol *scaleVolume) (string, error) {
-	fsetResponse, err := scaleVol.Connector.ListFileset(scaleVol.VolBackendFs, scaleVol.VolName)
+	fsetResponse, err := scaleVol.Connector.ListFileset(scaleVol.VolBackendFs, scaleVol.FilesetName)
 	if err != nil {
-		_ = cs.Cleanup(scaleVol)
-		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", scaleVol.VolName, scaleVol.VolBackendFs, err))
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", scaleVol.FilesetName, scaleVol.VolBackendFs, err))
 	}
 
 	linkpath := fsetResponse.Config.Path
@@ -213,7 +424,10 @@ func (cs *ScaleControllerServer) GetTargetPathforFset(scVol *scaleVolume) (strin
 	}
 	targetPath := strings.Replace(linkpath, fsMountPt, "", 1)
 	targetPath = strings.Trim(targetPath, "!/")
-	targetPath = fmt.Sprintf("%s/%s-data", targetPath, scVol.VolName)
+	/* The data of an AFM cache is the content of its home, so the whole fileset is the volume */
+	if !scVol.isAfmCache() {
+		targetPath = fmt.Sprintf("%s/%s-data", targetPath, scVol.VolName)
+	}
 	return targetPath, nil
 }
 
@@ -230,13 +444,40 @@ func (cs *ScaleControllerServer) CreateFilesetBasedVol(scVol *scaleVolume) (stri
 		return "", status.Error(codes.Internal, fmt.Sprintf("Filesystem %v in cluster %v is not mounted", scVol.VolBackendFs, scVol.ClusterId))
 	}
 
-	if scVol.VolSize != 0 {
+	if scVol.needsQuota() {
 		err = scVol.Connector.CheckIfFSQuotaEnabled(scVol.VolBackendFs)
 		if err != nil {
 			return "", status.Error(codes.Internal, fmt.Sprintf("Quota not enabled for Filesystem %v inside cluster %v", scVol.VolBackendFs, scVol.ClusterId))
 		}
 	}
 
+	/* Unknown or invalid policy templates are reported before the fileset is created */
+	_, err = cs.RenderPolicyTemplates(scVol)
+	if err != nil {
+		return "", err
+	}
+
+	/* Fail rather than create an unencrypted volume */
+	if len(scVol.EncryptionKeys) != 0 {
+		encrypted, err := scVol.Connector.IsFilesystemEncryptionEnabled(scVol.VolBackendFs)
+		if err != nil {
+			return "", status.Error(codes.Internal, fmt.Sprintf("Unable to check if encryption is enabled for FS [%v]. Error [%v]", scVol.VolBackendFs, err))
+		}
+		if !encrypted {
+			return "", status.Error(codes.FailedPrecondition, fmt.Sprintf("Encryption is not enabled for Filesystem %v inside cluster %v", scVol.VolBackendFs, scVol.ClusterId))
+		}
+	}
+
+	if scVol.StoragePool != "" {
+		pools, err := scVol.Connector.ListStoragePools(scVol.VolBackendFs)
+		if err != nil {
+			return "", status.Error(codes.Internal, fmt.Sprintf("Unable to list storage pools of FS [%v]. Error [%v]", scVol.VolBackendFs, err))
+		}
+		if !utils.StringInSlice(scVol.StoragePool, pools) {
+			return "", status.Error(codes.InvalidArgument, fmt.Sprintf("Storage pool [%v] does not exist in FS [%v] of cluster %v", scVol.StoragePool, scVol.VolBackendFs, scVol.ClusterId))
+		}
+	}
+
 	if scVol.VolUid != "" {
 		opt[connectors.UserSpecifiedUid] = scVol.VolUid
 	}
@@ -252,41 +493,102 @@ func (cs *ScaleControllerServer) CreateFilesetBasedVol(scVol *scaleVolume) (stri
 	if scVol.ParentFileset != "" {
 		opt[connectors.UserSpecifiedParentFset] = scVol.ParentFileset
 	}
+	if scVol.IamMode != "" {
+		opt[connectors.UserSpecifiedIamMode] = scVol.IamMode
+	}
+	if scVol.PermChangeMode != "" {
+		opt[connectors.UserSpecifiedPermChangeMode] = scVol.PermChangeMode
+	}
+	/* The fileset is the root directory of AFM cache volumes */
+	if scVol.isAfmCache() && scVol.Permissions != "" {
+		opt[connectors.UserSpecifiedPermissions] = scVol.Permissions
+	}
+	if scVol.isAfmCache() {
+		opt[connectors.UserSpecifiedAfmMode] = scVol.AfmMode
+		opt[connectors.UserSpecifiedAfmTarget] = scVol.AfmTarget
+		if scVol.AfmAsyncDelay != "" {
+			opt[connectors.UserSpecifiedAfmAsyncDelay] = scVol.AfmAsyncDelay
+		}
+	}
+
+	comment, err := newFilesetComment(cs.Driver.name, scVol).format()
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("Unable to record volume [%v] in fileset comment, shorten the volume name or snapshotSchedule. Error [%v]", scVol.VolName, err))
+	}
+	opt[connectors.FilesetComment] = comment
 
-	fseterr := scVol.Connector.CreateFileset(scVol.VolBackendFs, scVol.VolName, opt)
+	fseterr := scVol.Connector.CreateFileset(scVol.VolBackendFs, scVol.FilesetName, opt)
 
 	if fseterr != nil {
 		/* Fileset creation failed, but in some cases GUI returns failure when fileset was created but not linked. So delete a incomplete created fileset, so that in next iteration we can create fresh one. */
 
-		_, err := scVol.Connector.ListFileset(scVol.VolBackendFs, scVol.VolName)
+		fset, err := scVol.Connector.ListFileset(scVol.VolBackendFs, scVol.FilesetName)
 
-		if err == nil {
+		if err == nil && isFilesetOwner(fset, scVol.VolName) {
 			_ = cs.Cleanup(scVol)
 		}
 
-		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to create fileset [%v] in FS [%v]. Error [%v]", scVol.VolName, scVol.VolBackendFs, fseterr))
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to create fileset [%v] in FS [%v]. Error [%v]", scVol.FilesetName, scVol.VolBackendFs, fseterr))
+	}
+
+	/* Creation of an existing fileset succeeds, make sure it was not created for another volume */
+	fset, err := scVol.Connector.ListFileset(scVol.VolBackendFs, scVol.FilesetName)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", scVol.FilesetName, scVol.VolBackendFs, err))
+	}
+	if !isFilesetOwner(fset, scVol.VolName) {
+		return "", status.Error(codes.AlreadyExists, fmt.Sprintf("Fileset [%v] in FS [%v] belongs to another volume", scVol.FilesetName, scVol.VolBackendFs))
+	}
+	err = checkFilesetAfm(scVol, fset)
+	if err != nil {
+		return "", err
+	}
+	err = checkFilesetIamMode(scVol, fset)
+	if err != nil {
+		return "", err
 	}
 
-	isFilesetLinked, err := scVol.Connector.IsFilesetLinked(scVol.VolBackendFs, scVol.VolName)
+	isFilesetLinked, err := scVol.Connector.IsFilesetLinked(scVol.VolBackendFs, scVol.FilesetName)
 
 	if err != nil {
 		_ = cs.Cleanup(scVol)
-		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to check if Fset [%v] in FS [%v] is linked. Error [%v]", scVol.VolName, scVol.VolBackendFs, err))
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to check if Fset [%v] in FS [%v] is linked. Error [%v]", scVol.FilesetName, scVol.VolBackendFs, err))
 	}
 
 	if !isFilesetLinked {
 		_ = cs.Cleanup(scVol)
-		return "", status.Error(codes.Internal, fmt.Sprintf("Fileset [%v] was created in FS [%v] but was not linked", scVol.VolName, scVol.VolBackendFs))
+		return "", status.Error(codes.Internal, fmt.Sprintf("Fileset [%v] was created in FS [%v] but was not linked", scVol.FilesetName, scVol.VolBackendFs))
 	}
 
-	if scVol.VolSize != 0 {
-		volsiz := strconv.FormatUint(scVol.VolSize, 10)
+	err = cs.SetPlacementPolicy(scVol)
+	if err != nil {
+		_ = cs.Cleanup(scVol)
+		return "", err
+	}
+
+	err = cs.SetEncryptionPolicy(scVol)
+	if err != nil {
+		_ = cs.Cleanup(scVol)
+		return "", err
+	}
+
+	err = cs.SetTemplatePolicy(scVol)
+	if err != nil {
+		_ = cs.Cleanup(scVol)
+		return "", err
+	}
+
+	if scVol.needsQuota() {
+		volsiz := ""
+		if scVol.VolSize != 0 {
+			volsiz = strconv.FormatUint(scVol.VolSize, 10)
+		}
 
-		err = scVol.Connector.SetFilesetQuota(scVol.VolBackendFs, scVol.VolName, volsiz)
+		err = scVol.Connector.SetFilesetQuota(scVol.VolBackendFs, scVol.FilesetName, volsiz, scVol.getQuotaRequestOptions())
 
 		if err != nil {
 			_ = cs.Cleanup(scVol)
-			return "", status.Error(codes.Internal, fmt.Sprintf("Fileset [%v] was created in FS [%v] but not able to set quota [%v]", scVol.VolName, scVol.VolBackendFs, scVol.VolSize))
+			return "", status.Error(codes.Internal, fmt.Sprintf("Fileset [%v] was created in FS [%v] but not able to set quota [%v]", scVol.FilesetName, scVol.VolBackendFs, scVol.VolSize))
 		}
 	}
 
@@ -299,11 +601,21 @@ func (cs *ScaleControllerServer) CreateFilesetBasedVol(scVol *scaleVolume) (stri
 		return "", err
 	}
 
-	err = scVol.Connector.MakeDirectory(scVol.VolBackendFs, targetBasePath, scVol.VolUid, scVol.VolGid)
+	if scVol.isAfmCache() {
+		glog.Infof("AFM cache fileset [%v] in FS [%v] created with mode [%v] for target [%v]", scVol.FilesetName, scVol.VolBackendFs, fset.AFM.AFMMode, fset.AFM.AFMTarget)
+	} else {
+		err = scVol.Connector.MakeDirectory(scVol.VolBackendFs, targetBasePath, scVol.VolUid, scVol.VolGid, scVol.Permissions)
+
+		if err != nil {
+			_ = cs.Cleanup(scVol)
+			return "", status.Error(codes.Internal, fmt.Sprintf("Unable to create dir [%v] in FS [%v]", targetBasePath, scVol.VolBackendFs))
+		}
+	}
 
+	err = cs.SetVolumeACL(scVol, scVol.Connector, targetBasePath)
 	if err != nil {
 		_ = cs.Cleanup(scVol)
-		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to create dir [%v] in FS [%v]", targetBasePath, scVol.VolBackendFs))
+		return "", err
 	}
 
 	return targetBasePath, err
@@ -323,10 +635,185 @@ func (cs *ScaleControllerServer) GetConnFromClusterID(cid string) (connectors.Sp
 	return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to get connector for ClusterID : %v", cid))
 }
 
+// ResolveFilesetName sets the name of the fileset of a volume. Without fileset
+// name template the fileset is named after the volume. A name generated from
+// the template which is taken by a fileset of another volume gets a suffix
+// derived from the volume name. Only a fileset that does not exist is free.
+func (cs *ScaleControllerServer) ResolveFilesetName(scVol *scaleVolume) error {
+	scVol.FilesetName = scVol.VolName
+	if scVol.FilesetNameTpl == "" {
+		return nil
+	}
+
+	if scVol.PVCName == "" || scVol.PVCNamespace == "" {
+		return status.Error(codes.FailedPrecondition, "filesetNameTemplate requires pvc metadata, the external-provisioner must be started with --extra-create-metadata")
+	}
+
+	params := filesetNameParams{Namespace: scVol.PVCNamespace, PVCName: scVol.PVCName, PVName: scVol.VolName}
+	name, err := renderFilesetName(scVol.FilesetNameTpl, params)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Unable to generate fileset name from filesetNameTemplate [%v]. Error [%v]", scVol.FilesetNameTpl, err))
+	}
+
+	for _, candidate := range []string{name, getFilesetNameWithSuffix(name, scVol.VolName)} {
+		fset, err := scVol.Connector.ListFileset(scVol.VolBackendFs, candidate)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", candidate, scVol.VolBackendFs, err))
+		}
+		if err != nil || isFilesetOwner(fset, scVol.VolName) {
+			scVol.FilesetName = candidate
+			glog.Infof("Using fileset name [%v] for volume [%v]", candidate, scVol.VolName)
+			return nil
+		}
+		glog.Infof("Fileset [%v] in FS [%v] belongs to another volume", candidate, scVol.VolBackendFs)
+	}
+	return status.Error(codes.AlreadyExists, fmt.Sprintf("Filesets generated from filesetNameTemplate for volume [%v] belong to other volumes", scVol.VolName))
+}
+
+// CheckFilesetRetention verifies that no file of a volume in a fileset of an
+// immutable IAM mode is under retention, before anything of the volume is
+// deleted. dataPath is the path of the volume on the node of the controller,
+// files are only inspected, so a refused delete leaves the volume intact. It
+// returns true if the fileset is immutable.
+func (cs *ScaleControllerServer) CheckFilesetRetention(conn connectors.SpectrumScaleConnector, filesystemName string, filesetName string, dataPath string) (bool, error) {
+	fset, err := conn.ListFileset(filesystemName, filesetName)
+	if err != nil {
+		return false, status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+
+	iamMode := iamModes[strings.ToLower(fset.Config.IamMode)]
+	if !isImmutable(iamMode) {
+		return false, nil
+	}
+
+	retained, err := findRetainedFile(dataPath, time.Now())
+	if err != nil {
+		return true, status.Error(codes.FailedPrecondition, fmt.Sprintf("Fset [%v] in FS [%v] has IAM mode [%v] and retention of its files can not be verified, the filesystem must be mounted on the node of the controller. Error [%v]", filesetName, filesystemName, iamMode, err))
+	}
+	if retained != "" {
+		return true, status.Error(codes.FailedPrecondition, fmt.Sprintf("Fset [%v] in FS [%v] has IAM mode [%v] and file [%v] is still under retention", filesetName, filesystemName, iamMode, retained))
+	}
+	return true, nil
+}
+
+// IsFilesetOwnedBy returns true if the fileset was created for volume pvName.
+func (cs *ScaleControllerServer) IsFilesetOwnedBy(conn connectors.SpectrumScaleConnector, filesystemName string, filesetName string, pvName string) bool {
+	if filesetName == pvName {
+		return true
+	}
+	fset, err := conn.ListFileset(filesystemName, filesetName)
+	if err != nil {
+		glog.Errorf("Unable to list Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err)
+		return false
+	}
+	return isFilesetOwner(fset, pvName)
+}
+
+// SetPlacementPolicy installs a placement rule for the fileset of a volume
+// when a storage pool is requested.
+func (cs *ScaleControllerServer) SetPlacementPolicy(scVol *scaleVolume) error {
+	if scVol.StoragePool == "" {
+		return nil
+	}
+	rule := getPlacementRule(scVol.FilesetName, scVol.StoragePool)
+	err := cs.UpdateFilesetPolicy(scVol.Connector, scVol.VolBackendFs, scVol.FilesetName, policyKindPlacement, rule)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to set placement policy for Fset [%v] in FS [%v]. Error [%v]", scVol.FilesetName, scVol.VolBackendFs, err))
+	}
+	return nil
+}
+
+// SetEncryptionPolicy installs the rules encrypting the files of the fileset
+// of a volume when encryption keys are requested.
+func (cs *ScaleControllerServer) SetEncryptionPolicy(scVol *scaleVolume) error {
+	if len(scVol.EncryptionKeys) == 0 {
+		return nil
+	}
+	rules := getEncryptionRules(scVol.FilesetName, scVol.EncryptionAlgo, scVol.EncryptionKeys)
+	err := cs.UpdateFilesetPolicy(scVol.Connector, scVol.VolBackendFs, scVol.FilesetName, policyKindEncryption, rules)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to set encryption policy for Fset [%v] in FS [%v]. Error [%v]", scVol.FilesetName, scVol.VolBackendFs, err))
+	}
+	return nil
+}
+
+// RenderPolicyTemplates returns the rules of the policy templates of a volume
+// rendered for its fileset.
+func (cs *ScaleControllerServer) RenderPolicyTemplates(scVol *scaleVolume) (string, error) {
+	params := policyTemplateParams{
+		Fileset:    scVol.FilesetName,
+		Filesystem: scVol.VolBackendFs,
+		PVName:     scVol.VolName,
+		PVCName:    scVol.PVCName,
+		Namespace:  scVol.PVCNamespace,
+	}
+
+	var rules []string
+	for _, name := range scVol.PolicyTemplates {
+		tpl, ok := cs.Driver.GetPolicyTemplate(name)
+		if !ok {
+			return "", status.Error(codes.InvalidArgument, fmt.Sprintf("Policy template [%v] specified in storageClass is not defined in the driver configuration", name))
+		}
+		rule, err := renderPolicyTemplate(tpl, params)
+		if err != nil {
+			return "", status.Error(codes.InvalidArgument, fmt.Sprintf("Unable to render policy template [%v] for Fset [%v]. Error [%v]", name, scVol.FilesetName, err))
+		}
+		rules = append(rules, rule)
+	}
+	return strings.Join(rules, "\n"), nil
+}
+
+// SetTemplatePolicy installs the rules of the policy templates of a volume for
+// its fileset.
+func (cs *ScaleControllerServer) SetTemplatePolicy(scVol *scaleVolume) error {
+	if len(scVol.PolicyTemplates) == 0 {
+		return nil
+	}
+	rules, err := cs.RenderPolicyTemplates(scVol)
+	if err != nil {
+		return err
+	}
+	err = cs.UpdateFilesetPolicy(scVol.Connector, scVol.VolBackendFs, scVol.FilesetName, policyKindTemplate, rules)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to set policy template rules for Fset [%v] in FS [%v]. Error [%v]", scVol.FilesetName, scVol.VolBackendFs, err))
+	}
+	return nil
+}
+
+// RemoveFilesetPolicy removes the policy rules of a fileset before it is
+// deleted, policy rules must not refer to unknown filesets. The policy is only
+// changed for filesets whose comment records policy rules.
+func (cs *ScaleControllerServer) RemoveFilesetPolicy(conn connectors.SpectrumScaleConnector, filesystemName string, filesetName string) error {
+	fset, err := conn.ListFileset(filesystemName, filesetName)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+	if !hasFilesetPolicyRules(fset) {
+		return nil
+	}
+	err = cs.UpdateFilesetPolicy(conn, filesystemName, filesetName, "", "")
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to remove policy rules of Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+	return nil
+}
+
 func (cs *ScaleControllerServer) Cleanup(scVol *scaleVolume) error {
 	var err error
+	if scVol.NfsExportPath != "" {
+		err = scVol.Connector.DeleteNfsExport(scVol.NfsExportPath)
+		if err != nil {
+			glog.Errorf("Unable to delete NFS export %s: %v", scVol.NfsExportPath, err)
+		}
+	}
 	if scVol.IsFilesetBased {
-		err = scVol.Connector.DeleteFileset(scVol.VolBackendFs, scVol.VolName)
+		if scVol.hasPolicyRules() {
+			err = cs.UpdateFilesetPolicy(scVol.Connector, scVol.VolBackendFs, scVol.FilesetName, "", "")
+			if err != nil {
+				glog.Errorf("Unable to remove policy rules of fileset %s: %v", scVol.FilesetName, err)
+			}
+		}
+		err = scVol.Connector.DeleteFileset(scVol.VolBackendFs, scVol.FilesetName)
 	} else {
 		dirPath := fmt.Sprintf("%s/%s", scVol.VolDirBasePath, scVol.VolName)
 		glog.Infof("Directory path to be deleted [%v]", dirPath)
@@ -335,6 +822,19 @@ func (cs *ScaleControllerServer) Cleanup(scVol *scaleVolume) error {
 	return err
 }
 
+// CleanupWithSymlink deletes the symlink of a volume in the primary fileset,
+// unless the volume is in direct path mode, together with the volume.
+func (cs *ScaleControllerServer) CleanupWithSymlink(scVol *scaleVolume) error {
+	if !scVol.isDirectPath() {
+		lnkPath := fmt.Sprintf("%s/%s", scVol.PrimarySLnkRelPath, scVol.VolName)
+		err := scVol.PrimaryConnector.DeleteSymLnk(scVol.PrimaryFS, lnkPath)
+		if err != nil {
+			glog.Errorf("Unable to delete symlink %s: %v", lnkPath, err)
+		}
+	}
+	return cs.Cleanup(scVol)
+}
+
 func (cs *ScaleControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) { //nolint:gocyclo,funlen
 	glog.V(3).Infof("create volume req: %v", req)
 
@@ -352,6 +852,10 @@ func (cs *ScaleControllerServer) CreateVolume(ctx context.Context, req *csi.Crea
 		return nil, status.Error(codes.InvalidArgument, "Volume Name is a required field")
 	}
 
+	if req.GetVolumeContentSource() != nil {
+		return nil, status.Error(codes.InvalidArgument, "Volumes can not be created from a snapshot or volume")
+	}
+
 	/* Get volume size in bytes */
 	volSize, err := cs.GetVolumeSizeInBytes(req)
 
@@ -379,16 +883,32 @@ func (cs *ScaleControllerServer) CreateVolume(ctx context.Context, req *csi.Crea
 		return nil, err
 	}
 
+	for _, reqCap := range reqCapabilities {
+		mountOptionLists := append([]string{scaleVol.MountOptions}, reqCap.GetMount().GetMountFlags()...)
+		if _, err := parseMountOptions(mountOptionLists...); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid mount options: %v", err))
+		}
+	}
+
 	scaleVol.VolName = volName
 	scaleVol.VolSize = uint64(volSize)
 
+	if !scaleVol.IsFilesetBased && scaleVol.VolSize != 0 && scaleVol.QuotaEnforcement == quotaEnforcementStrict {
+		return nil, status.Error(codes.InvalidArgument, "Capacity of directory based volumes can not be enforced, quotaEnforcement=strict requires fileset based volumes or a volume size of 0")
+	}
+
 	/* Get details for Primary Cluster */
-	pConn, PSLnkRelPath, PFS, PFSMount, PSLnkPath, PCid, err := cs.GetPriConnAndSLnkPath()
+	pConn, PSLnkRelPath, PFS, PFSMount, PSLnkPath, PCid, err := cs.GetPriConnAndSLnkPath(scaleVol.PrimaryName)
 
 	if err != nil {
 		return nil, err
 	}
 
+	/* Record the default primary by name, so that the volume keeps it if the default changes */
+	if scaleVol.PrimaryName == "" {
+		scaleVol.PrimaryName = cs.Driver.primary.Name
+	}
+
 	scaleVol.PrimaryConnector = pConn
 	scaleVol.PrimarySLnkRelPath = PSLnkRelPath
 	scaleVol.PrimaryFS = PFS
@@ -422,6 +942,10 @@ func (cs *ScaleControllerServer) CreateVolume(ctx context.Context, req *csi.Crea
 		}
 
 		scaleVol.Connector = conn
+
+		grace := cs.Driver.GetQuotaGracePeriod(scaleVol.ClusterId, scaleVol.VolBackendFs)
+		scaleVol.BlockGracePeriod = grace.BlockGracePeriod
+		scaleVol.FilesGracePeriod = grace.FilesGracePeriod
 	} else {
 		scaleVol.Connector = scaleVol.PrimaryConnector
 		scaleVol.ClusterId = PCid
@@ -448,6 +972,11 @@ func (cs *ScaleControllerServer) CreateVolume(ctx context.Context, req *csi.Crea
 	/* Check if Volume already present */
 	var isPresent bool
 	if scaleVol.IsFilesetBased {
+		err = cs.ResolveFilesetName(scaleVol)
+		if err != nil {
+			return nil, err
+		}
+
 		isPresent, err = cs.IfFileSetBasedVolExist(scaleVol)
 		if err != nil {
 			return nil, err
@@ -459,17 +988,56 @@ func (cs *ScaleControllerServer) CreateVolume(ctx context.Context, req *csi.Crea
 		}
 	}
 
+	volTopology, err := cs.GetAccessibleTopology(scaleVol, PCid)
+	if err != nil {
+		return nil, err
+	}
+
 	if isPresent {
-		volId, err := cs.GenerateVolId(scaleVol)
+		targetPath := fmt.Sprintf("%s/%s", scaleVol.VolDirBasePath, scaleVol.VolName)
+		if scaleVol.IsFilesetBased {
+			err = cs.SetPlacementPolicy(scaleVol)
+			if err != nil {
+				return nil, err
+			}
+			err = cs.SetEncryptionPolicy(scaleVol)
+			if err != nil {
+				return nil, err
+			}
+			err = cs.SetTemplatePolicy(scaleVol)
+			if err != nil {
+				return nil, err
+			}
+
+			targetPath, err = cs.GetTargetPathforFset(scaleVol)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(scaleVol.NfsClients) != 0 {
+			err = cs.ExportVolume(scaleVol, targetPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		volId, err := cs.GenerateVolId(scaleVol, targetPath)
+		if err != nil {
+			return nil, err
+		}
+
+		volContext, err := cs.GetVolumeContext(scaleVol, req.GetParameters(), targetPath)
 		if err != nil {
 			return nil, err
 		}
 
 		return &csi.CreateVolumeResponse{
 			Volume: &csi.Volume{
-				VolumeId:      volId,
-				CapacityBytes: int64(scaleVol.VolSize),
-				VolumeContext: req.GetParameters(),
+				VolumeId:           volId,
+				CapacityBytes:      scaleVol.getCapacityBytes(),
+				VolumeContext:      volContext,
+				AccessibleTopology: volTopology,
 			},
 		}, nil
 	}
@@ -490,75 +1058,139 @@ func (cs *ScaleControllerServer) CreateVolume(ctx context.Context, req *csi.Crea
 		targetPath = fmt.Sprintf("%s/%s", scaleVol.VolDirBasePath, scaleVol.VolName)
 	}
 
-	/* Create a Symlink */
+	/* Create a Symlink, volumes in direct path mode are published from their data path */
+
+	if !scaleVol.isDirectPath() {
+		lnkPath := fmt.Sprintf("%s/%s", scaleVol.PrimarySLnkRelPath, scaleVol.VolName)
 
-	lnkPath := fmt.Sprintf("%s/%s", scaleVol.PrimarySLnkRelPath, scaleVol.VolName)
+		glog.Infof("Symlink info FS [%v] TargetFS [%v]  target Path [%v] lnkPath [%v]", scaleVol.PrimaryFS, scaleVol.LocalFS, targetPath, lnkPath)
 
-	glog.Infof("Symlink info FS [%v] TargetFS [%v]  target Path [%v] lnkPath [%v]", scaleVol.PrimaryFS, scaleVol.LocalFS, targetPath, lnkPath)
+		err = scaleVol.PrimaryConnector.CreateSymLink(scaleVol.PrimaryFS, scaleVol.LocalFS, targetPath, lnkPath)
 
-	err = scaleVol.PrimaryConnector.CreateSymLink(scaleVol.PrimaryFS, scaleVol.LocalFS, targetPath, lnkPath)
+		if err != nil {
+			_ = cs.Cleanup(scaleVol)
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Failed to create symlink [%v] in FS [%v], for target [%v] in FS [%v]. Error [%v]", lnkPath, scaleVol.PrimaryFS, targetPath, scaleVol.LocalFS, err))
+		}
+	}
+
+	if len(scaleVol.NfsClients) != 0 {
+		err = cs.ExportVolume(scaleVol, targetPath)
+		if err != nil {
+			_ = cs.CleanupWithSymlink(scaleVol)
+			return nil, err
+		}
+	}
 
+	volId, err := cs.GenerateVolId(scaleVol, targetPath)
 	if err != nil {
-		_ = cs.Cleanup(scaleVol)
-		return nil, status.Error(codes.Internal, fmt.Sprintf("Failed to create symlink [%v] in FS [%v], for target [%v] in FS [%v]. Error [%v]", lnkPath, scaleVol.PrimaryFS, targetPath, scaleVol.LocalFS, err))
+		_ = cs.CleanupWithSymlink(scaleVol)
+		return nil, err
 	}
 
-	volId, err := cs.GenerateVolId(scaleVol)
+	volContext, err := cs.GetVolumeContext(scaleVol, req.GetParameters(), targetPath)
 	if err != nil {
-		_ = cs.Cleanup(scaleVol)
 		return nil, err
 	}
 
 	return &csi.CreateVolumeResponse{
 		Volume: &csi.Volume{
-			VolumeId:      volId,
-			CapacityBytes: int64(scaleVol.VolSize),
-			VolumeContext: req.GetParameters(),
+			VolumeId:           volId,
+			CapacityBytes:      scaleVol.getCapacityBytes(),
+			VolumeContext:      volContext,
+			AccessibleTopology: volTopology,
 		},
 	}, nil
 }
 
-func (cs *ScaleControllerServer) GetVolIdMembers(vId string) (scaleVolId, error) {
-	splitVid := strings.Split(vId, ";")
-	var vIdMem scaleVolId
+// GetVolumeContext returns the storageClass parameters together with the
+// resolved backend details of a volume. targetPath is the path of the volume
+// data relative to the mount point of the volume filesystem.
+func (cs *ScaleControllerServer) GetVolumeContext(scVol *scaleVolume, params map[string]string, targetPath string) (map[string]string, error) {
+	fsMountPoint, dataPath, err := cs.GetDataPath(scVol, targetPath)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(splitVid) == 3 {
-		/* This is LW volume */
-		/* <cluster_id>;<filesystem_uuid>;path=<symlink_path> */
-		vIdMem.ClusterId = splitVid[0]
-		vIdMem.FsUUID = splitVid[1]
-		SlnkPart := splitVid[2]
-		slnkSplit := strings.Split(SlnkPart, "=")
-		if len(slnkSplit) < 2 {
-			return scaleVolId{}, status.Error(codes.Internal, fmt.Sprintf("Invalid Volume Id : [%v]", vId))
+	volContext := make(map[string]string)
+	for key, value := range params {
+		volContext[key] = value
+	}
+	volContext[volCtxFsName] = scVol.LocalFS
+	volContext[volCtxFsMountPoint] = fsMountPoint
+	volContext[volCtxDataPath] = dataPath
+	if scVol.NfsExportLocation != "" {
+		volContext[volCtxNfsExport] = scVol.NfsExportLocation
+	}
+	if scVol.IsFilesetBased {
+		volContext[volCtxVolumeType] = volumeid.TypeFileset
+		volContext[volCtxFilesetName] = scVol.FilesetName
+		if scVol.isAfmCache() {
+			fset, err := scVol.Connector.ListFileset(scVol.VolBackendFs, scVol.FilesetName)
+			if err != nil {
+				return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", scVol.FilesetName, scVol.VolBackendFs, err))
+			}
+			volContext[volCtxAfmMode] = fset.AFM.AFMMode
+			volContext[volCtxAfmTarget] = fset.AFM.AFMTarget
 		}
-		vIdMem.SymLnkPath = slnkSplit[1]
-		vIdMem.IsFilesetBased = false
-		return vIdMem, nil
+	} else {
+		volContext[volCtxVolumeType] = volumeid.TypeDirectory
 	}
+	return volContext, nil
+}
+
+// GetDataPath returns the mount point of the volume filesystem in the primary
+// cluster and the absolute path of the volume data below it.
+func (cs *ScaleControllerServer) GetDataPath(scVol *scaleVolume, targetPath string) (string, string, error) {
+	fsMountPoint, err := scVol.PrimaryConnector.GetFilesystemMountpoint(scVol.LocalFS)
+	if err != nil {
+		return "", "", status.Error(codes.Internal, fmt.Sprintf("Unable to get mount point of FS [%v] in Primary cluster. Error [%v]", scVol.LocalFS, err))
+	}
+	return fsMountPoint, path.Join(fsMountPoint, targetPath), nil
+}
 
-	if len(splitVid) == 4 {
-		/* This is fileset Based volume */
-		/* <cluster_id>;<filesystem_uuid>;fileset=<fileset_id>; path=<symlink_path> */
-		vIdMem.ClusterId = splitVid[0]
-		vIdMem.FsUUID = splitVid[1]
-		fileSetPart := splitVid[2]
-		fileSetSplit := strings.Split(fileSetPart, "=")
-		if len(fileSetSplit) < 2 {
-			return scaleVolId{}, status.Error(codes.Internal, fmt.Sprintf("Invalid Volume Id : [%v]", vId))
+func (cs *ScaleControllerServer) GetVolIdMembers(vId string) (volumeid.VolumeID, error) {
+	vIdMem, err := volumeid.Decode(vId)
+	if err != nil {
+		return volumeid.VolumeID{}, status.Error(codes.Internal, fmt.Sprintf("Invalid Volume Id : [%v]. Error [%v]", vId, err))
+	}
+	return vIdMem, nil
+}
+
+// ResolveVolumeId returns the fields of the volume ID a fileset based volume
+// was migrated to, and volumeIdMembers if the volume was not migrated. The
+// volume ID of a persistent volume can not be changed, so the volume stays
+// available under its old ID. Volumes being migrated are not available until
+// the migration is completed and the old fileset is deleted, so that no data
+// is written to the old fileset.
+func (cs *ScaleControllerServer) ResolveVolumeId(volumeID string, volumeIdMembers volumeid.VolumeID) (volumeid.VolumeID, error) {
+	if !volumeIdMembers.IsFilesetBased() || volumeIdMembers.IsDirectPath() {
+		return volumeIdMembers, nil
+	}
+
+	/* A migrated volume may have been migrated again under its new ID */
+	resolved := map[string]bool{volumeID: true}
+	for {
+		entry, found, err := cs.Driver.journal.Get(operationMigrate, volumeID)
+		if err != nil {
+			return volumeid.VolumeID{}, status.Error(codes.Internal, fmt.Sprintf("Unable to read operation journal. Error [%v]", err))
+		}
+		if !found {
+			return volumeIdMembers, nil
 		}
-		vIdMem.FsetId = fileSetSplit[1]
-		SlnkPart := splitVid[3]
-		slnkSplit := strings.Split(SlnkPart, "=")
-		if len(slnkSplit) < 2 {
-			return scaleVolId{}, status.Error(codes.Internal, fmt.Sprintf("Invalid Volume Id : [%v]", vId))
+		if !entry.reached(migrateStepDone) {
+			return volumeid.VolumeID{}, status.Error(codes.FailedPrecondition, fmt.Sprintf("Volume [%v] is being migrated to FS [%v] of cluster [%v], the migration must be completed first", volumeID, entry.TargetFs, entry.TargetCluster))
 		}
-		vIdMem.SymLnkPath = slnkSplit[1]
-		vIdMem.IsFilesetBased = true
-		return vIdMem, nil
+		if resolved[entry.NewVolumeID] {
+			return volumeid.VolumeID{}, status.Error(codes.Internal, fmt.Sprintf("Migrations of volume [%v] form a cycle", volumeID))
+		}
+		volumeIdMembers, err = volumeid.Decode(entry.NewVolumeID)
+		if err != nil {
+			return volumeid.VolumeID{}, status.Error(codes.Internal, fmt.Sprintf("Invalid volume Id [%v] of migrated volume [%v]. Error [%v]", entry.NewVolumeID, volumeID, err))
+		}
+		glog.V(4).Infof("Volume [%v] was migrated, using volume Id [%v]", volumeID, entry.NewVolumeID)
+		volumeID = entry.NewVolumeID
+		resolved[volumeID] = true
 	}
-
-	return scaleVolId{}, status.Error(codes.Internal, fmt.Sprintf("Invalid Volume Id : [%v]", vId))
 }
 
 func (cs *ScaleControllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
@@ -580,6 +1212,11 @@ func (cs *ScaleControllerServer) DeleteVolume(ctx context.Context, req *csi.Dele
 		return &csi.DeleteVolumeResponse{}, nil
 	}
 
+	volumeIdMembers, err = cs.ResolveVolumeId(volumeID, volumeIdMembers)
+	if err != nil {
+		return nil, err
+	}
+
 	glog.Infof("Volume Id Members [%v]", volumeIdMembers)
 
 	conn, err := cs.GetConnFromClusterID(volumeIdMembers.ClusterId)
@@ -588,10 +1225,10 @@ func (cs *ScaleControllerServer) DeleteVolume(ctx context.Context, req *csi.Dele
 		return nil, err
 	}
 
-	primaryConn, isprimaryConnPresent := cs.Driver.connmap["primary"]
+	primary, primaryConn, err := cs.Driver.GetPrimary(volumeIdMembers.PrimaryName)
 
-	if !isprimaryConnPresent {
-		return nil, status.Error(codes.Internal, "Unable to get connector for Primary cluster")
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to get primary of volume [%v]. Error [%v]", volumeID, err))
 	}
 
 	/* FsUUID in volumeIdMembers will be of Primary cluster. So lets get Name of it
@@ -615,10 +1252,30 @@ func (cs *ScaleControllerServer) DeleteVolume(ctx context.Context, req *csi.Dele
 
 	FilesystemName = remDevFs
 
-	sLinkRelPath := strings.Replace(volumeIdMembers.SymLnkPath, cs.Driver.primary.PrimaryFSMount, "", 1)
-	sLinkRelPath = strings.Trim(sLinkRelPath, "!/")
+	/* Volumes in symlink mode are deleted through their symlink in the primary
+	   fileset, volumes in direct path mode through their data path */
+	sLinkRelPath := ""
+	dirFs := primary.GetPrimaryFs()
+	dirRelPath := ""
+	pvName := ""
+
+	if volumeIdMembers.IsDirectPath() {
+		fsMountPoint, err := primaryConn.GetFilesystemMountpoint(volumeIdMembers.FsName)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to get mount point of FS [%v] in primary cluster. Error [%v]", volumeIdMembers.FsName, err))
+		}
+		dirFs = volumeIdMembers.FsName
+		dirRelPath = strings.Trim(strings.TrimPrefix(volumeIdMembers.SymLnkPath, fsMountPoint), "!/")
+		/* The data path of AFM cache volumes is the link path of their fileset, which is identified by the fileset ID */
+		pvName = strings.TrimSuffix(filepath.Base(dirRelPath), "-data")
+	} else {
+		sLinkRelPath = strings.Replace(volumeIdMembers.SymLnkPath, primary.PrimaryFSMount, "", 1)
+		sLinkRelPath = strings.Trim(sLinkRelPath, "!/")
+		dirRelPath = sLinkRelPath
+		pvName = filepath.Base(sLinkRelPath)
+	}
 
-	if volumeIdMembers.IsFilesetBased {
+	if volumeIdMembers.IsFilesetBased() {
 		FilesetName, err := conn.GetFileSetNameFromId(FilesystemName, volumeIdMembers.FsetId)
 		if err != nil {
 			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to get Fileset Name for Id [%v] FS [%v] ClusterId [%v]", volumeIdMembers.FsetId, FilesystemName, volumeIdMembers.ClusterId))
@@ -626,29 +1283,66 @@ func (cs *ScaleControllerServer) DeleteVolume(ctx context.Context, req *csi.Dele
 
 		if FilesetName != "" {
 			/* Confirm it is same fileset which was created for this PV */
-			pvName := filepath.Base(sLinkRelPath)
-			if pvName == FilesetName {
+			if cs.IsFilesetOwnedBy(conn, FilesystemName, FilesetName, pvName) {
+				immutable, err := cs.CheckFilesetRetention(conn, FilesystemName, FilesetName, volumeIdMembers.SymLnkPath)
+				if err != nil {
+					return nil, err
+				}
+
+				err = cs.DeleteVolumeExport(conn, volumeIdMembers, FilesystemName, FilesetName, pvName)
+				if err != nil {
+					return nil, err
+				}
+
+				err = cs.DeleteScheduledSnapshots(conn, FilesystemName, FilesetName)
+				if err != nil {
+					return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to delete scheduled snapshots of Fileset [%v] for FS [%v] and clusterId [%v]. Error [%v]", FilesetName, FilesystemName, volumeIdMembers.ClusterId, err))
+				}
+
+				err = cs.RemoveFilesetPolicy(conn, FilesystemName, FilesetName)
+				if err != nil {
+					return nil, err
+				}
+
 				err = conn.DeleteFileset(FilesystemName, FilesetName)
 
+				if err != nil && immutable && isRetentionError(err) {
+					return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("Unable to Delete Fileset [%v] for FS [%v] and clusterId [%v], files of the fileset may still be under retention. Error [%v]", FilesetName, FilesystemName, volumeIdMembers.ClusterId, err))
+				}
 				if err != nil {
-					return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to Delete Fileset [%v] for FS [%v] and clusterId [%v]", FilesetName, FilesystemName, volumeIdMembers.ClusterId))
+					return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to Delete Fileset [%v] for FS [%v] and clusterId [%v]. Error [%v]", FilesetName, FilesystemName, volumeIdMembers.ClusterId, err))
 				}
 			} else {
-				glog.Infof("PV name from path [%v] does not match with filesetName [%v]. Skipping delete of fileset", pvName, FilesetName)
+				glog.Infof("Fileset [%v] was not created for PV [%v]. Skipping delete of fileset", FilesetName, pvName)
 			}
 		}
 	} else {
+		err = cs.DeleteVolumeExport(conn, volumeIdMembers, FilesystemName, "", pvName)
+		if err != nil {
+			return nil, err
+		}
+
 		/* Delete Dir for Lw volume */
-		err = primaryConn.DeleteDirectory(cs.Driver.primary.GetPrimaryFs(), sLinkRelPath)
+		err = primaryConn.DeleteDirectory(dirFs, dirRelPath)
 		if err != nil {
-			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to Delete Dir using FS [%v] Relative SymLink [%v]", cs.Driver.primary.GetPrimaryFs(), sLinkRelPath))
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to Delete Dir using FS [%v] Relative Path [%v]", dirFs, dirRelPath))
 		}
 	}
 
-	err = primaryConn.DeleteSymLnk(cs.Driver.primary.GetPrimaryFs(), sLinkRelPath)
+	if !volumeIdMembers.IsDirectPath() {
+		err = primaryConn.DeleteSymLnk(primary.GetPrimaryFs(), sLinkRelPath)
 
-	if err != nil {
-		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to delete symlnk [%v:%v] Error [%v]", cs.Driver.primary.GetPrimaryFs(), sLinkRelPath, err))
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to delete symlnk [%v:%v] Error [%v]", primary.GetPrimaryFs(), sLinkRelPath, err))
+		}
+	}
+
+	if volumeIdMembers.IsFilesetBased() {
+		/* The volume ID no longer needs to be resolved through its migration */
+		err = cs.Driver.journal.RemoveVolume(volumeID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to remove volume [%v] from operation journal. Error [%v]", volumeID, err))
+		}
 	}
 
 	return &csi.DeleteVolumeResponse{}, nil
@@ -696,10 +1390,71 @@ func (cs *ScaleControllerServer) ControllerUnpublishVolume(ctx context.Context,
 
 	volumeID := req.GetVolumeId()
 
-	/* <cluster_id>;<filesystem_uuid>;path=<symlink_path> */
-	splitVolID := strings.Split(volumeID, ";")
-	if len(splitVolID) < 3 {
-		return nil, status.Error(codes.InvalidArgument, "ControllerUnpublishVolume VolumeID is not in proper format")
+	volumeIdMembers, err := volumeid.Decode(volumeID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("ControllerUnpublishVolume VolumeID is not in proper format. Error [%v]", err))
+	}
+	volumeIdMembers, err = cs.ResolveVolumeId(volumeID, volumeIdMembers)
+	if err != nil {
+		return nil, err
+	}
+	filesystemID := volumeIdMembers.FsUUID
+
+	nodeID := req.GetNodeId()
+	if nodeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "NodeID not present")
+	}
+
+	primary, primaryConn, err := cs.Driver.GetPrimary(volumeIdMembers.PrimaryName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerUnpublishVolume : Unable to get primary of volume %s. Error [%v]", volumeID, err))
+	}
+
+	//Get filesystem name from UUID
+	fsName, err := primaryConn.GetFilesystemName(filesystemID)
+	if err != nil {
+		glog.Errorf("ControllerUnpublishVolume : Error in getting filesystem Name for filesystem ID of %s.", filesystemID)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerUnpublishVolume : Error in getting filesystem Name for filesystem ID of %s. Error [%v]", filesystemID, err))
+	}
+
+	scalenodeID := cs.Driver.nodeMapper.GetScaleNodeName(nodeID)
+
+	// Primary filesystem is never unmounted
+	if fsName == primary.GetPrimaryFs() {
+		err = cs.Driver.publishTracker.RemoveVolume(scalenodeID, fsName, volumeID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerUnpublishVolume : Unable to record volume %s as unpublished from node %s. Error [%v]", volumeID, scalenodeID, err))
+		}
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	}
+
+	unlock := cs.Driver.publishTracker.lockNodeFs(scalenodeID, fsName)
+	defer unlock()
+
+	isLastVolume, mountedByDriver, err := cs.Driver.publishTracker.IsLastVolume(scalenodeID, fsName, volumeID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerUnpublishVolume : Unable to get volumes published on node %s. Error [%v]", scalenodeID, err))
+	}
+
+	// if SKIP_MOUNT_UNMOUNT == "yes" then mount/unmount will not be invoked
+	skipMountUnmount := utils.GetEnv("SKIP_MOUNT_UNMOUNT", yes)
+	if isLastVolume && mountedByDriver && skipMountUnmount == no {
+		glog.V(4).Infof("ControllerUnpublishVolume : unmounting %s from %s as last volume %s is unpublished", fsName, scalenodeID, volumeID)
+		err = primaryConn.UnmountFilesystem(fsName, scalenodeID)
+		if err != nil {
+			// The volume stays recorded as published, so that the unmount is retried
+			glog.Errorf("ControllerUnpublishVolume : Error in unmounting filesystem %s from node %s. Error [%v]", fsName, scalenodeID, err)
+			return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerUnpublishVolume : Error in unmounting filesystem %s from node %s. Error [%v]", fsName, scalenodeID, err))
+		}
+		err = cs.Driver.publishTracker.ClearMountOptions(scalenodeID, fsName)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerUnpublishVolume : Unable to clear mount options of filesystem %s on node %s. Error [%v]", fsName, scalenodeID, err))
+		}
+	}
+
+	err = cs.Driver.publishTracker.RemoveVolume(scalenodeID, fsName, volumeID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerUnpublishVolume : Unable to record volume %s as unpublished from node %s. Error [%v]", volumeID, scalenodeID, err))
 	}
 
 	return &csi.ControllerUnpublishVolumeResponse{}, nil
@@ -730,46 +1485,77 @@ func (cs *ScaleControllerServer) ControllerPublishVolume(ctx context.Context, re
 
 	var isFsMounted bool
 
-	/* VolumeID format : <cluster_id>;<filesystem_uuid>;path=<symlink_path> */
 	//Assumption : filesystem_uuid is always from local/primary cluster.
-	splitVolID := strings.Split(volumeID, ";")
-	if len(splitVolID) < 3 {
-		return nil, status.Error(codes.InvalidArgument, "ControllerPublishVolume : VolumeID is not in proper format")
+	volumeIdMembers, err := volumeid.Decode(volumeID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("ControllerPublishVolume : VolumeID is not in proper format. Error [%v]", err))
+	}
+	volumeIdMembers, err = cs.ResolveVolumeId(volumeID, volumeIdMembers)
+	if err != nil {
+		return nil, err
 	}
-	filesystemID := splitVolID[1]
+	filesystemID := volumeIdMembers.FsUUID
 
 	// if SKIP_MOUNT_UNMOUNT == "yes" then mount/unmount will not be invoked
 	skipMountUnmount := utils.GetEnv("SKIP_MOUNT_UNMOUNT", yes)
 	glog.V(4).Infof("ControllerPublishVolume : SKIP_MOUNT_UNMOUNT is set to %s", skipMountUnmount)
 
+	primary, primaryConn, err := cs.Driver.GetPrimary(volumeIdMembers.PrimaryName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume : Unable to get primary of volume %s. Error [%v]", volumeID, err))
+	}
+
 	//Get filesystem name from UUID
-	fsName, err := cs.Driver.connmap["primary"].GetFilesystemName(filesystemID)
+	fsName, err := primaryConn.GetFilesystemName(filesystemID)
 	if err != nil {
 		glog.Errorf("ControllerPublishVolume : Error in getting filesystem Name for filesystem ID of %s.", filesystemID)
 		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume : Error in getting filesystem Name for filesystem ID of %s. Error [%v]", filesystemID, err))
 	}
 
 	//Check if primary filesystem is mounted.
-	primaryfsName := cs.Driver.primary.GetPrimaryFs()
-	pfsMount, err := cs.Driver.connmap["primary"].GetFilesystemMountDetails(primaryfsName)
+	primaryfsName := primary.GetPrimaryFs()
+	pfsMount, err := primaryConn.GetFilesystemMountDetails(primaryfsName)
 	if err != nil {
 		glog.Errorf("ControllerPublishVolume : Error in getting filesystem mount details for %s", primaryfsName)
 		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume : Error in getting filesystem mount details for %s. Error [%v]", primaryfsName, err))
 	}
 
+	// Mount options for the volume filesystem are the driver level, storageClass level and volume capability mount options
+	driverMountOptions, err := parseMountOptions(utils.GetEnv("SCALE_MOUNT_OPTIONS", ""))
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume : Invalid SCALE_MOUNT_OPTIONS. Error [%v]", err))
+	}
+	mountOptionLists := []string{driverMountOptions, req.GetVolumeContext()[connectors.UserSpecifiedMountOptions]}
+	mountOptionLists = append(mountOptionLists, req.GetVolumeCapability().GetMount().GetMountFlags()...)
+	volMountOptions, err := parseMountOptions(mountOptionLists...)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("ControllerPublishVolume : Invalid mount options for volume %s. Error [%v]", volumeID, err))
+	}
+
 	// Node mapping check
-	scalenodeID := utils.GetEnv(nodeID, notFound)
-	// Additional node mapping check in case of k8s node id start with number.
-	if scalenodeID == notFound {
-		prefix := utils.GetEnv("SCALE_NODE_MAPPING_PREFIX", "K8sNodePrefix_")
-		scalenodeID = utils.GetEnv(prefix+nodeID, notFound)
-		if scalenodeID == notFound {
-			glog.V(4).Infof("ControllerPublishVolume : scale node mapping not found for %s using %s", prefix+nodeID, nodeID)
-			scalenodeID = nodeID
+	scalenodeID := cs.Driver.nodeMapper.GetScaleNodeName(nodeID)
+
+	glog.V(4).Infof("ControllerPublishVolume : scalenodeID:%s --known as-- k8snodeName: %s", scalenodeID, nodeID)
+
+	// Check if node is an active node of the primary cluster
+	scaleNode, err := primaryConn.GetNode(scalenodeID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			glog.Errorf("ControllerPublishVolume : node %s is not a node of the primary cluster", scalenodeID)
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("ControllerPublishVolume : node %s (kubernetes node %s) is not a node of the primary cluster, check the node mapping", scalenodeID, nodeID))
 		}
+		glog.Errorf("ControllerPublishVolume : Error in getting details of node %s", scalenodeID)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume : Error in getting details of node %s. Error [%v]", scalenodeID, err))
+	}
+	if !strings.EqualFold(scaleNode.Status.GPFSState, gpfsStateActive) {
+		glog.Errorf("ControllerPublishVolume : GPFS state of node %s is %s", scalenodeID, scaleNode.Status.GPFSState)
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("ControllerPublishVolume : GPFS state of node %s is %s, expected %s", scalenodeID, scaleNode.Status.GPFSState, gpfsStateActive))
 	}
 
-	glog.V(4).Infof("ControllerUnpublishVolume : scalenodeID:%s --known as-- k8snodeName: %s", scalenodeID, nodeID)
+	// Serialize with unpublish of volumes from the same filesystem on this node
+	unlock := cs.Driver.publishTracker.lockNodeFs(scalenodeID, fsName)
+	defer unlock()
+
 	ispFsMounted := utils.StringInSlice(scalenodeID, pfsMount.NodesMounted)
 
 	glog.V(4).Infof("ControllerPublishVolume : Primary FS is mounted on %v", pfsMount.NodesMounted)
@@ -777,7 +1563,7 @@ func (cs *ScaleControllerServer) ControllerPublishVolume(ctx context.Context, re
 	// Skip if primary filesystem and volume filesystem is same
 	if primaryfsName != fsName {
 		//Check if filesystem is mounted
-		fsMount, err := cs.Driver.connmap["primary"].GetFilesystemMountDetails(fsName)
+		fsMount, err := primaryConn.GetFilesystemMountDetails(fsName)
 		if err != nil {
 			glog.Errorf("ControllerPublishVolume : Error in getting filesystem mount details for %s", fsName)
 			return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume : Error in getting filesystem mount details for %s. Error [%v]", fsName, err))
@@ -788,9 +1574,26 @@ func (cs *ScaleControllerServer) ControllerPublishVolume(ctx context.Context, re
 		isFsMounted = ispFsMounted
 	}
 
+	// Volumes in direct path mode are published without symlink in the primary filesystem
+	if volumeIdMembers.IsDirectPath() && primaryfsName != fsName && !ispFsMounted {
+		glog.V(4).Infof("ControllerPublishVolume : volume %s does not need primary filesystem %s on %s", volumeID, primaryfsName, scalenodeID)
+		ispFsMounted = true
+	}
+
 	glog.V(4).Infof("ControllerPublishVolume : Mount Status Primaryfs [ %t ], Sourcefs [ %t ]", ispFsMounted, isFsMounted)
+	if isFsMounted {
+		err = cs.CheckMountOptions(scalenodeID, fsName, volMountOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if isFsMounted && ispFsMounted {
 		glog.V(4).Infof("ControllerPublishVolume : %s and %s are mounted on %s so returning success", fsName, primaryfsName, scalenodeID)
+		err = cs.TrackPublishedVolume(scalenodeID, primaryfsName, fsName, volumeID, false)
+		if err != nil {
+			return nil, err
+		}
 		return &csi.ControllerPublishVolumeResponse{}, nil
 	}
 
@@ -801,36 +1604,349 @@ func (cs *ScaleControllerServer) ControllerPublishVolume(ctx context.Context, re
 
 	//mount the primary filesystem if not mounted
 	if !(ispFsMounted) && skipMountUnmount == no {
-		glog.V(4).Infof("ControllerPublishVolume : mounting Filesystem %s on %s", primaryfsName, scalenodeID)
-		err = cs.Driver.connmap["primary"].MountFilesystem(primaryfsName, scalenodeID)
+		primaryMountOptions := driverMountOptions
+		if primaryfsName == fsName {
+			primaryMountOptions = volMountOptions
+		}
+		glog.V(4).Infof("ControllerPublishVolume : mounting Filesystem %s on %s with options [%s]", primaryfsName, scalenodeID, primaryMountOptions)
+		err = primaryConn.MountFilesystem(primaryfsName, scalenodeID, primaryMountOptions)
 		if err != nil {
 			glog.Errorf("ControllerPublishVolume : Error in mounting filesystem %s on node %s", primaryfsName, scalenodeID)
 			return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume :  Error in mounting filesystem %s on node %s. Error [%v]", primaryfsName, scalenodeID, err))
 		}
+		err = cs.TrackMountOptions(scalenodeID, primaryfsName, primaryMountOptions)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	//mount the volume filesystem if mounted
 	if !(isFsMounted) && skipMountUnmount == no && primaryfsName != fsName {
-		glog.V(4).Infof("ControllerPublishVolume : mounting %s on %s", fsName, scalenodeID)
-		err = cs.Driver.connmap["primary"].MountFilesystem(fsName, scalenodeID)
+		glog.V(4).Infof("ControllerPublishVolume : mounting %s on %s with options [%s]", fsName, scalenodeID, volMountOptions)
+		err = primaryConn.MountFilesystem(fsName, scalenodeID, volMountOptions)
 		if err != nil {
 			glog.Errorf("ControllerPublishVolume : Error in mounting filesystem %s on node %s", fsName, scalenodeID)
 			return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume : Error in mounting filesystem %s on node %s. Error [%v]", fsName, scalenodeID, err))
 		}
+		err = cs.TrackMountOptions(scalenodeID, fsName, volMountOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = cs.TrackPublishedVolume(scalenodeID, primaryfsName, fsName, volumeID, !isFsMounted)
+	if err != nil {
+		return nil, err
 	}
 	return &csi.ControllerPublishVolumeResponse{}, nil
 }
 
-func (cs *ScaleControllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+// CheckMountOptions verifies that a filesystem mounted on a node by the driver
+// was mounted with the mount options requested for a volume.
+func (cs *ScaleControllerServer) CheckMountOptions(scalenodeID string, fsName string, volMountOptions string) error {
+	mountOptions, mountedByDriver, err := cs.Driver.publishTracker.GetMountOptions(scalenodeID, fsName)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume : Unable to get mount options of filesystem %s on node %s. Error [%v]", fsName, scalenodeID, err))
+	}
+	if !mountedByDriver {
+		if volMountOptions != "" {
+			glog.Warningf("ControllerPublishVolume : filesystem %s was not mounted on node %s by the driver, unable to verify mount options [%s]", fsName, scalenodeID, volMountOptions)
+		}
+		return nil
+	}
+	if mountOptions != volMountOptions {
+		glog.Errorf("ControllerPublishVolume : filesystem %s is mounted on node %s with options [%s], volume requests [%s]", fsName, scalenodeID, mountOptions, volMountOptions)
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("ControllerPublishVolume : filesystem %s is mounted on node %s with mount options [%s] which conflict with the mount options [%s] of the volume", fsName, scalenodeID, mountOptions, volMountOptions))
+	}
+	return nil
+}
+
+// TrackMountOptions records the options of a filesystem mounted on a node by the driver.
+func (cs *ScaleControllerServer) TrackMountOptions(scalenodeID string, fsName string, mountOptions string) error {
+	err := cs.Driver.publishTracker.SetMountOptions(scalenodeID, fsName, mountOptions)
+	if err != nil {
+		glog.Errorf("Unable to record mount options of filesystem %s on node %s: %v", fsName, scalenodeID, err)
+		return status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume : Unable to record mount options of filesystem %s on node %s. Error [%v]", fsName, scalenodeID, err))
+	}
+	return nil
+}
+
+// TrackPublishedVolume records a volume published on a node. Volumes of the
+// primary filesystem are tracked as not mounted by the driver, as the primary
+// filesystem is never unmounted.
+func (cs *ScaleControllerServer) TrackPublishedVolume(scalenodeID string, primaryfsName string, fsName string, volumeID string, mountedByDriver bool) error {
+	if primaryfsName == fsName {
+		mountedByDriver = false
+	}
+	err := cs.Driver.publishTracker.AddVolume(scalenodeID, fsName, volumeID, mountedByDriver)
+	if err != nil {
+		glog.Errorf("Unable to record volume %s as published on node %s: %v", volumeID, scalenodeID, err)
+		return status.Error(codes.Internal, fmt.Sprintf("ControllerPublishVolume : Unable to record volume %s as published on node %s. Error [%v]", volumeID, scalenodeID, err))
+	}
+	return nil
+}
+
+// CreateSnapshot snapshots the independent fileset owning the inode space of
+// a fileset based volume, which is the parent fileset of dependent fileset
+// based volumes.
+func (cs *ScaleControllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) { //nolint:funlen
+	glog.V(3).Infof("create snapshot req: %v", req)
+
+	if err := cs.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT); err != nil {
+		glog.V(3).Infof("invalid create snapshot req: %v", req)
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("CreateSnapshot ValidateControllerServiceRequest failed: %v", err))
+	}
+
+	name := req.GetName()
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot name is a required field")
+	}
+	volumeID := req.GetSourceVolumeId()
+	if volumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Source volume ID is a required field")
+	}
+
+	volumeIdMembers, err := cs.GetVolIdMembers(volumeID)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("Invalid Volume Id [%v]", volumeID))
+	}
+	volumeIdMembers, err = cs.ResolveVolumeId(volumeID, volumeIdMembers)
+	if err != nil {
+		return nil, err
+	}
+	if !volumeIdMembers.IsFilesetBased() {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume [%v] is not fileset based, only fileset based volumes can be snapshot", volumeID))
+	}
+
+	conn, err := cs.GetConnFromClusterID(volumeIdMembers.ClusterId)
+	if err != nil {
+		return nil, err
+	}
+
+	filesystemName, filesetName, err := cs.GetFilesetOfVolume(conn, volumeIdMembers)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := cs.GetInodeSpaceOwner(conn, filesystemName, filesetName)
+	if err != nil {
+		return nil, err
+	}
+	if owner.Config.Id == 0 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume [%v] is in the inode space of the root fileset of FS [%v], snapshots of the filesystem are not supported", volumeID, filesystemName))
+	}
+
+	snapshots, err := conn.ListFilesetSnapshots(filesystemName, owner.FilesetName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to list snapshots of Fset [%v] in FS [%v]. Error [%v]", owner.FilesetName, filesystemName, err))
+	}
+
+	/* A retried request finds the snapshot created for the snapshot name */
+	snapshotName := ""
+	namePrefix := volumeSnapshotNamePrefix(name)
+	for _, snapshot := range snapshots {
+		if strings.HasPrefix(snapshot.SnapshotName, namePrefix) {
+			snapshotName = snapshot.SnapshotName
+			break
+		}
+	}
+	if snapshotName == "" {
+		snapshotName = namePrefix + time.Now().UTC().Format(groupSnapshotTimeFormat)
+		err = conn.CreateFilesetSnapshot(filesystemName, owner.FilesetName, snapshotName)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to create snapshot [%v] of Fset [%v] in FS [%v]. Error [%v]", snapshotName, owner.FilesetName, filesystemName, err))
+		}
+		glog.Infof("Created snapshot %s of fileset %s in FS %s for snapshot %s", snapshotName, owner.FilesetName, filesystemName, name)
+	}
+
+	created, _ := parseVolumeSnapshotName(snapshotName)
+	creationTime, err := ptypes.TimestampProto(created)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Invalid creation time of snapshot [%v]. Error [%v]", snapshotName, err))
+	}
+
+	return &csi.CreateSnapshotResponse{
+		Snapshot: &csi.Snapshot{
+			SnapshotId:     encodeSnapshotId(snapshotName, volumeIdMembers),
+			SourceVolumeId: volumeID,
+			CreationTime:   creationTime,
+			ReadyToUse:     true,
+		},
+	}, nil
 }
 
+// DeleteSnapshot deletes a snapshot created through CSI. Scheduled snapshots
+// are deleted by the snapshot scheduler and snapshots of group snapshots with
+// their group snapshot.
 func (cs *ScaleControllerServer) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+	glog.V(3).Infof("delete snapshot req: %v", req)
+
+	if err := cs.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT); err != nil {
+		glog.V(3).Infof("invalid delete snapshot req: %v", req)
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("DeleteSnapshot ValidateControllerServiceRequest failed: %v", err))
+	}
+
+	snapshotID := req.GetSnapshotId()
+	if snapshotID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot ID is a required field")
+	}
+	snapshotName, snapVolume, err := decodeSnapshotId(snapshotID)
+	if err != nil {
+		glog.Infof("Snapshot ID [%v] does not reference a snapshot of the driver. Error [%v]", snapshotID, err)
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+	if _, ok := parseVolumeSnapshotName(snapshotName); !ok {
+		return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("Snapshot [%v] is a scheduled snapshot or a snapshot of a group snapshot and can not be deleted on its own", snapshotID))
+	}
+
+	conn, err := cs.GetConnFromClusterID(snapVolume.ClusterId)
+	if err != nil {
+		return nil, err
+	}
+
+	filesystemName, filesetName, err := cs.GetFilesetOfVolume(conn, snapVolume)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			glog.Infof("Fileset of snapshot [%v] not found, the snapshot is deleted", snapshotID)
+			return &csi.DeleteSnapshotResponse{}, nil
+		}
+		return nil, err
+	}
+	owner, err := cs.GetInodeSpaceOwner(conn, filesystemName, filesetName)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := conn.ListFilesetSnapshots(filesystemName, owner.FilesetName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to list snapshots of Fset [%v] in FS [%v]. Error [%v]", owner.FilesetName, filesystemName, err))
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotName != snapshotName {
+			continue
+		}
+		err = conn.DeleteFilesetSnapshot(filesystemName, owner.FilesetName, snapshotName)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to delete snapshot [%v] of Fset [%v] in FS [%v]. Error [%v]", snapshotName, owner.FilesetName, filesystemName, err))
+		}
+		glog.Infof("Deleted snapshot %s of fileset %s in FS %s", snapshotName, owner.FilesetName, filesystemName)
+	}
+
+	return &csi.DeleteSnapshotResponse{}, nil
 }
 
-func (cs *ScaleControllerServer) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+// ListSnapshots lists the scheduled, volume and group snapshots of a volume.
+// Snapshots of all volumes can not be listed, filesets found by the snapshot
+// scheduler do not reference their volume. Snapshots listed by snapshot ID only report a volume
+// ID of their fileset in direct path mode as source volume ID.
+func (cs *ScaleControllerServer) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) { //nolint:gocyclo,funlen
+	if err := cs.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS); err != nil {
+		glog.Warningf("invalid list snapshots req: %v", req)
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid list snapshots req (%v): %v", req, err))
+	}
+
+	volumeID := req.GetSourceVolumeId()
+	snapshotName := ""
+	var volumeIdMembers volumeid.VolumeID
+	if volumeID != "" {
+		var err error
+		volumeIdMembers, err = volumeid.Decode(volumeID)
+		if err != nil || !volumeIdMembers.IsFilesetBased() {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		volumeIdMembers, err = cs.ResolveVolumeId(volumeID, volumeIdMembers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if snapshotID := req.GetSnapshotId(); snapshotID != "" {
+		name, snapVolume, err := decodeSnapshotId(snapshotID)
+		if err != nil || (volumeID != "" && !isSnapshotOfVolume(snapVolume, volumeIdMembers)) {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		if volumeID == "" {
+			volumeIdMembers = snapVolume
+		}
+		snapshotName = name
+	}
+
+	if volumeID == "" && snapshotName == "" {
+		return nil, status.Error(codes.Unimplemented, "Snapshots can only be listed by source volume ID or snapshot ID")
+	}
+
+	conn, err := cs.GetConnFromClusterID(volumeIdMembers.ClusterId)
+	if err != nil {
+		return nil, err
+	}
+
+	filesystemName, filesetName, err := cs.GetFilesetOfVolume(conn, volumeIdMembers)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		return nil, err
+	}
+
+	if volumeID == "" {
+		volumeID, err = cs.GetFilesetVolumeId(conn, volumeIdMembers, filesystemName, filesetName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	/* Group snapshots of dependent fileset based volumes are snapshots of the parent fileset */
+	owner, err := cs.GetInodeSpaceOwner(conn, filesystemName, filesetName)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := conn.ListFilesetSnapshots(filesystemName, owner.FilesetName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to list snapshots of Fset [%v] in FS [%v]. Error [%v]", owner.FilesetName, filesystemName, err))
+	}
+
+	entries := []*csi.ListSnapshotsResponse_Entry{}
+	for _, name := range getDriverSnapshots(snapshots) {
+		if snapshotName != "" && name != snapshotName {
+			continue
+		}
+		created, _ := parseSnapshotName(name)
+		creationTime, err := ptypes.TimestampProto(created)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Invalid creation time of snapshot [%v]. Error [%v]", name, err))
+		}
+		groupSnapshotId := ""
+		if _, ok := parseGroupSnapshotName(name); ok {
+			groupSnapshotId = encodeSnapshotId(name, getFilesetKey(volumeIdMembers, owner))
+		}
+		entries = append(entries, &csi.ListSnapshotsResponse_Entry{
+			Snapshot: &csi.Snapshot{
+				SnapshotId:      encodeSnapshotId(name, volumeIdMembers),
+				SourceVolumeId:  volumeID,
+				CreationTime:    creationTime,
+				ReadyToUse:      true,
+				GroupSnapshotId: groupSnapshotId,
+			},
+		})
+	}
+
+	start := 0
+	if token := req.GetStartingToken(); token != "" {
+		start, err = strconv.Atoi(token)
+		if err != nil || start < 0 || start > len(entries) {
+			return nil, status.Error(codes.Aborted, fmt.Sprintf("Invalid starting token [%v]", token))
+		}
+	}
+	end := len(entries)
+	nextToken := ""
+	if maxEntries := int(req.GetMaxEntries()); maxEntries > 0 && start+maxEntries < end {
+		end = start + maxEntries
+		nextToken = strconv.Itoa(end)
+	}
+
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries[start:end],
+		NextToken: nextToken,
+	}, nil
 }
 
 func (cs *ScaleControllerServer) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
@@ -839,6 +1955,160 @@ func (cs *ScaleControllerServer) GetCapacity(ctx context.Context, req *csi.GetCa
 func (cs *ScaleControllerServer) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "")
 }
-func (cs *ScaleControllerServer) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
+func (cs *ScaleControllerServer) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "")
 }
+func (cs *ScaleControllerServer) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) { //nolint:funlen
+	glog.V(3).Infof("expand volume req: %v", req)
+
+	if err := cs.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_EXPAND_VOLUME); err != nil {
+		glog.V(3).Infof("invalid expand volume req: %v", req)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("ControllerExpandVolume ValidateControllerServiceRequest failed: %v", err))
+	}
+
+	volumeID := req.GetVolumeId()
+	if volumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume Id is a required field")
+	}
+
+	capRange := req.GetCapacityRange()
+	if capRange == nil {
+		return nil, status.Error(codes.InvalidArgument, "Capacity Range is a required field")
+	}
+	newSize := capRange.GetRequiredBytes()
+	if capRange.GetLimitBytes() > 0 && newSize > capRange.GetLimitBytes() {
+		return nil, status.Error(codes.OutOfRange, fmt.Sprintf("Required bytes %v exceed limit bytes %v", newSize, capRange.GetLimitBytes()))
+	}
+
+	volumeIdMembers, err := cs.GetVolIdMembers(volumeID)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("Invalid Volume Id [%v]", volumeID))
+	}
+	volumeIdMembers, err = cs.ResolveVolumeId(volumeID, volumeIdMembers)
+	if err != nil {
+		return nil, err
+	}
+
+	if !volumeIdMembers.IsFilesetBased() {
+		/* Directory based volumes have no quota, there is nothing to expand and their capacity is unknown */
+		return &csi.ControllerExpandVolumeResponse{CapacityBytes: 0}, nil
+	}
+
+	conn, err := cs.GetConnFromClusterID(volumeIdMembers.ClusterId)
+	if err != nil {
+		return nil, err
+	}
+
+	filesystemName, filesetName, err := cs.GetFilesetOfVolume(conn, volumeIdMembers)
+	if err != nil {
+		return nil, err
+	}
+
+	quota, err := conn.GetFilesetQuotaDetails(filesystemName, filesetName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to list quota for Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+
+	currentSize := int64(quota.BlockLimit) * 1024
+	if quota.BlockLimit != 0 && newSize <= currentSize {
+		glog.Infof("Fileset [%v] quota %v is already at least %v", filesetName, currentSize, newSize)
+		return &csi.ControllerExpandVolumeResponse{CapacityBytes: currentSize}, nil
+	}
+
+	/* Keep the ratio between block soft and hard limit. Setting the quota
+	   replaces all limits of the fileset, so the files limits are set again */
+	opts := make(map[string]interface{})
+	if quota.BlockLimit != 0 && quota.BlockQuota != quota.BlockLimit {
+		softLimit := uint64(float64(newSize) * float64(quota.BlockQuota) / float64(quota.BlockLimit))
+		opts[connectors.QuotaBlockSoftLimit] = strconv.FormatUint(softLimit, 10)
+	}
+	if quota.FilesLimit > 0 || quota.FilesQuota > 0 {
+		opts[connectors.UserSpecifiedFilesHardLimit] = quota.FilesLimit
+		opts[connectors.UserSpecifiedFilesSoftLimit] = quota.FilesQuota
+	}
+
+	err = conn.SetFilesetQuota(filesystemName, filesetName, strconv.FormatInt(newSize, 10), opts)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to set quota [%v] for Fset [%v] in FS [%v]. Error [%v]", newSize, filesetName, filesystemName, err))
+	}
+
+	return &csi.ControllerExpandVolumeResponse{CapacityBytes: newSize}, nil
+}
+
+// GetFilesetVolumeId returns the volume ID in direct path mode of the fileset
+// filesetName of filesystem filesystemName, in the cluster of volumeIdMembers.
+// The data path is the link path of AFM cache filesets and the data directory
+// of the volume recorded in the fileset comment otherwise.
+func (cs *ScaleControllerServer) GetFilesetVolumeId(conn connectors.SpectrumScaleConnector, volumeIdMembers volumeid.VolumeID, filesystemName string, filesetName string) (string, error) {
+	_, primaryConn, err := cs.Driver.GetPrimary(volumeIdMembers.PrimaryName)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to get primary of volume. Error [%v]", err))
+	}
+	primaryFsName, err := primaryConn.GetFilesystemName(volumeIdMembers.FsUUID)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to get filesystem Name for Id [%v]. Error [%v]", volumeIdMembers.FsUUID, err))
+	}
+	primaryMountPoint, err := primaryConn.GetFilesystemMountpoint(primaryFsName)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to get mount point of FS [%v] in primary cluster. Error [%v]", primaryFsName, err))
+	}
+	fsMountPoint, err := conn.GetFilesystemMountpoint(filesystemName)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to get mount point of FS [%v] in clusterId [%v]. Error [%v]", filesystemName, volumeIdMembers.ClusterId, err))
+	}
+	fset, err := conn.ListFileset(filesystemName, filesetName)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+
+	dataPath := path.Join(primaryMountPoint, strings.TrimPrefix(fset.Config.Path, fsMountPoint))
+	if fset.AFM.AFMTarget == "" {
+		pvName := filesetName
+		if comment, err := parseFilesetComment(fset.Config.Comment); err == nil {
+			pvName = comment.PVName
+		}
+		dataPath = path.Join(dataPath, pvName+"-data")
+	}
+
+	volId, err := volumeid.Encode(volumeid.VolumeID{
+		ClusterId:   volumeIdMembers.ClusterId,
+		FsUUID:      volumeIdMembers.FsUUID,
+		FsName:      primaryFsName,
+		VolType:     volumeid.TypeFileset,
+		FsetId:      volumeIdMembers.FsetId,
+		PathMode:    volumeid.PathModeDirect,
+		PrimaryName: volumeIdMembers.PrimaryName,
+		SymLnkPath:  dataPath,
+	})
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to generate volume Id of Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+	return volId, nil
+}
+
+// GetFilesetOfVolume returns the filesystem name, in the cluster owning the
+// filesystem, and the fileset name of a fileset based volume.
+func (cs *ScaleControllerServer) GetFilesetOfVolume(conn connectors.SpectrumScaleConnector, volumeIdMembers volumeid.VolumeID) (string, string, error) {
+	_, primaryConn, err := cs.Driver.GetPrimary(volumeIdMembers.PrimaryName)
+	if err != nil {
+		return "", "", status.Error(codes.Internal, fmt.Sprintf("Unable to get primary of volume. Error [%v]", err))
+	}
+
+	filesystemName, err := primaryConn.GetFilesystemName(volumeIdMembers.FsUUID)
+	if err != nil {
+		return "", "", status.Error(codes.Internal, fmt.Sprintf("Unable to get filesystem Name for Id [%v] and clusterId [%v]. Error [%v]", volumeIdMembers.FsUUID, volumeIdMembers.ClusterId, err))
+	}
+
+	mountInfo, err := primaryConn.GetFilesystemMountDetails(filesystemName)
+	if err != nil {
+		return "", "", status.Error(codes.Internal, fmt.Sprintf("Unable to get mount info for FS [%v] in primary cluster", filesystemName))
+	}
+	splitDevName := strings.Split(mountInfo.RemoteDeviceName, ":")
+	filesystemName = splitDevName[len(splitDevName)-1]
+
+	filesetName, err := conn.GetFileSetNameFromId(filesystemName, volumeIdMembers.FsetId)
+	if err != nil || filesetName == "" {
+		return "", "", status.Error(codes.NotFound, fmt.Sprintf("Unable to get Fileset Name for Id [%v] FS [%v] ClusterId [%v]", volumeIdMembers.FsetId, filesystemName, volumeIdMembers.ClusterId))
+	}
+	return filesystemName, filesetName, nil
+}
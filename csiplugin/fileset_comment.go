@@ -0,0 +1,172 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/volumeid"
+)
+
+// The comment of filesets created by the driver records the kubernetes
+// objects owning the fileset, e.g.
+//
+//	csi;v=1;drv=spectrumscale.csi.ibm.com;pv=pvc-8a3e...;ns=default;pvc=data;t=2019-11-04T10:00:00Z;idv=2
+//
+// Filesets created with retention period information carry ret=<days>, filesets with
+// scheduled snapshots snap=<interval>:<keep>, and filesets with rules in the
+// filesystem policy pol=1.
+//
+// Kubernetes names never contain ";" or "=". Fileset comments are limited to
+// 255 characters. If the comment gets too long, the informational fields pvc,
+// ns and idv are left out in this order. The other fields are required, the
+// lengths of the driver name and snapshot schedule are bounded, and volumes
+// whose required fields exceed the limit are rejected.
+const (
+	filesetCommentTag     = "csi"
+	filesetCommentVersion = "1"
+	filesetCommentMaxLen  = 255
+	filesetCommentPolicy  = "1"
+
+	filesetCommentMaxDriverLen   = 63
+	filesetCommentMaxScheduleLen = 32
+)
+
+type filesetComment struct {
+	Version      string
+	Driver       string
+	PVName       string
+	Namespace    string
+	PVCName      string
+	Created      string
+	VolIdVersion string
+	Retention    string
+	Schedule     string
+	Policy       string
+}
+
+func newFilesetComment(driverName string, scVol *scaleVolume) filesetComment {
+	retention := ""
+	if scVol.RetentionDays != 0 {
+		retention = strconv.FormatUint(scVol.RetentionDays, 10)
+	}
+	policy := ""
+	if scVol.hasPolicyRules() {
+		policy = filesetCommentPolicy
+	}
+	return filesetComment{
+		Version:      filesetCommentVersion,
+		Driver:       driverName,
+		PVName:       scVol.VolName,
+		Namespace:    scVol.PVCNamespace,
+		PVCName:      scVol.PVCName,
+		Created:      time.Now().UTC().Format(time.RFC3339),
+		VolIdVersion: strconv.Itoa(volumeid.Version2),
+		Retention:    retention,
+		Schedule:     scVol.SnapshotSchedule,
+		Policy:       policy,
+	}
+}
+
+// filesetCommentDropOrder lists the informational fields in the order they
+// are left out of a comment which is too long.
+var filesetCommentDropOrder = []string{"pvc", "ns", "idv"}
+
+// format returns the comment, leaving out informational fields if it is too
+// long. It fails if the required fields alone are too long.
+func (c filesetComment) format() (string, error) {
+	omit := make(map[string]bool)
+	comment := c.join(omit)
+	for _, key := range filesetCommentDropOrder {
+		if len(comment) <= filesetCommentMaxLen {
+			return comment, nil
+		}
+		omit[key] = true
+		comment = c.join(omit)
+	}
+	if len(comment) > filesetCommentMaxLen {
+		return comment, fmt.Errorf("fileset comment %q exceeds %d characters", comment, filesetCommentMaxLen)
+	}
+	return comment, nil
+}
+
+// join returns the comment without the fields in omit.
+func (c filesetComment) join(omit map[string]bool) string {
+	fields := []string{filesetCommentTag}
+	add := func(key string, value string) {
+		if value != "" && !omit[key] {
+			fields = append(fields, key+"="+value)
+		}
+	}
+	add("v", c.Version)
+	add("drv", c.Driver)
+	add("pv", c.PVName)
+	add("ret", c.Retention)
+	add("snap", c.Schedule)
+	add("pol", c.Policy)
+	add("ns", c.Namespace)
+	add("pvc", c.PVCName)
+	add("t", c.Created)
+	add("idv", c.VolIdVersion)
+	return strings.Join(fields, ";")
+}
+
+// parseFilesetComment parses the comment of a fileset created by the driver.
+func parseFilesetComment(comment string) (filesetComment, error) {
+	fields := strings.Split(comment, ";")
+	if len(fields) < 2 || fields[0] != filesetCommentTag {
+		return filesetComment{}, fmt.Errorf("comment %q was not written by the driver", comment)
+	}
+
+	c := filesetComment{}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return filesetComment{}, fmt.Errorf("invalid field %q in comment %q", field, comment)
+		}
+		switch kv[0] {
+		case "v":
+			c.Version = kv[1]
+		case "drv":
+			c.Driver = kv[1]
+		case "pv":
+			c.PVName = kv[1]
+		case "ns":
+			c.Namespace = kv[1]
+		case "pvc":
+			c.PVCName = kv[1]
+		case "t":
+			c.Created = kv[1]
+		case "idv":
+			c.VolIdVersion = kv[1]
+		case "ret":
+			c.Retention = kv[1]
+		case "snap":
+			c.Schedule = kv[1]
+		case "pol":
+			c.Policy = kv[1]
+		}
+	}
+
+	if c.Version == "" || c.PVName == "" {
+		return filesetComment{}, fmt.Errorf("comment %q misses version or pv name", comment)
+	}
+	return c, nil
+}
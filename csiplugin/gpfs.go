@@ -19,7 +19,10 @@ package scale
 import (
 	"fmt"
 	"path"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/connectors"
 	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/settings"
@@ -28,6 +31,7 @@ import (
 	"github.com/golang/glog"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/client-go/kubernetes"
 )
 
 // PluginFolder defines the location of scaleplugin
@@ -43,15 +47,37 @@ type ScaleDriver struct {
 	ids *ScaleIdentityServer
 	ns  *ScaleNodeServer
 	cs  *ScaleControllerServer
-
-	connmap map[string]connectors.SpectrumScaleConnector
-	cmap    settings.ScaleSettingsConfigMap
-	primary settings.Primary
-	reqmap  map[string]int64
-
-	vcap  []*csi.VolumeCapability_AccessMode
-	cscap []*csi.ControllerServiceCapability
-	nscap []*csi.NodeServiceCapability
+	gcs *ScaleGroupControllerServer
+
+	configSource settings.ConfigSource
+	// snapshotSchedulerInterval is the interval of the snapshot scheduler, 0 disables it
+	snapshotSchedulerInterval time.Duration
+	// inodeExpansion configures the growth of fileset inode limits, an interval of 0 disables it
+	inodeExpansion InodeExpansion
+	events         VolumeEventRecorder
+	// kubeClient is used to keep the state of the controller service in the
+	// cluster, it is kept in the plugin folder of the node if not set
+	kubeClient    kubernetes.Interface
+	kubeNamespace string
+	// configMux serializes updates of the configuration
+	configMux sync.Mutex
+
+	connmap    map[string]connectors.SpectrumScaleConnector
+	cmap       settings.ScaleSettingsConfigMap
+	primary    settings.Primary
+	primaries  []settings.Primary
+	reqmap     map[string]int64
+	nodeMapper *settings.NodeMapper
+
+	publishTracker *publishTracker
+	journal        *operationJournal
+	// policyMux serializes updates of filesystem policies
+	policyMux sync.Mutex
+
+	vcap   []*csi.VolumeCapability_AccessMode
+	cscap  []*csi.ControllerServiceCapability
+	gcscap []*csi.GroupControllerServiceCapability
+	nscap  []*csi.NodeServiceCapability
 }
 
 func GetScaleDriver() *ScaleDriver {
@@ -66,17 +92,29 @@ func NewIdentityServer(d *ScaleDriver) *ScaleIdentityServer {
 	}
 }
 
-func NewControllerServer(d *ScaleDriver, connMap map[string]connectors.SpectrumScaleConnector, cmap settings.ScaleSettingsConfigMap, primary settings.Primary) *ScaleControllerServer {
+// NewControllerServer returns the controller server. The first of primaries
+// is the default primary.
+func NewControllerServer(d *ScaleDriver, connMap map[string]connectors.SpectrumScaleConnector, cmap settings.ScaleSettingsConfigMap, primaries []settings.Primary) *ScaleControllerServer {
 	glog.V(3).Infof("gpfs NewControllerServer")
 	d.connmap = connMap
 	d.cmap = cmap
-	d.primary = primary
+	d.primary = primaries[0]
+	d.primaries = primaries
 	d.reqmap = make(map[string]int64)
+	d.publishTracker = newPublishTracker(d.newRecordStore(publishTrackerFile))
+	d.journal = newOperationJournal(d.newRecordStore(operationJournalFile))
 	return &ScaleControllerServer{
 		Driver: d,
 	}
 }
 
+func NewGroupControllerServer(d *ScaleDriver) *ScaleGroupControllerServer {
+	glog.V(3).Infof("gpfs NewGroupControllerServer")
+	return &ScaleGroupControllerServer{
+		Driver: d,
+	}
+}
+
 func NewNodeServer(d *ScaleDriver) *ScaleNodeServer {
 	glog.V(3).Infof("gpfs NewNodeServer")
 	return &ScaleNodeServer{
@@ -106,6 +144,17 @@ func (driver *ScaleDriver) AddControllerServiceCapabilities(cl []csi.ControllerS
 	return nil
 }
 
+func (driver *ScaleDriver) AddGroupControllerServiceCapabilities(gl []csi.GroupControllerServiceCapability_RPC_Type) error {
+	glog.V(3).Infof("gpfs AddGroupControllerServiceCapabilities")
+	var gcsc []*csi.GroupControllerServiceCapability
+	for _, g := range gl {
+		glog.V(3).Infof("Enabling group controller service capability: %v", g.String())
+		gcsc = append(gcsc, NewGroupControllerServiceCapability(g))
+	}
+	driver.gcscap = gcsc
+	return nil
+}
+
 func (driver *ScaleDriver) AddNodeServiceCapabilities(nl []csi.NodeServiceCapability_RPC_Type) error {
 	glog.V(3).Infof("gpfs AddNodeServiceCapabilities")
 	var nsc []*csi.NodeServiceCapability
@@ -130,13 +179,82 @@ func (driver *ScaleDriver) ValidateControllerServiceRequest(c csi.ControllerServ
 	return status.Error(codes.InvalidArgument, "Invalid controller service request")
 }
 
+func (driver *ScaleDriver) ValidateGroupControllerServiceRequest(g csi.GroupControllerServiceCapability_RPC_Type) error {
+	glog.V(3).Infof("gpfs ValidateGroupControllerServiceRequest")
+	for _, cap := range driver.gcscap {
+		if g == cap.GetRpc().Type {
+			return nil
+		}
+	}
+	return status.Error(codes.InvalidArgument, "Invalid group controller service request")
+}
+
+// SetConfigSource sets the source of the Spectrum Scale configuration. It
+// must be called before SetupScaleDriver, the configuration file is used by
+// default.
+func (driver *ScaleDriver) SetConfigSource(configSource settings.ConfigSource) {
+	driver.configSource = configSource
+}
+
+// SetSnapshotSchedulerInterval sets the interval in which scheduled snapshots
+// are created, 0 disables the snapshot scheduler. It must be called before
+// SetupScaleDriver.
+func (driver *ScaleDriver) SetSnapshotSchedulerInterval(interval time.Duration) {
+	driver.snapshotSchedulerInterval = interval
+}
+
+// SetInodeExpansion configures the growth of the inode limits of filesets. It
+// must be called before SetupScaleDriver.
+func (driver *ScaleDriver) SetInodeExpansion(expansion InodeExpansion) {
+	driver.inodeExpansion = expansion
+}
+
+// SetEventRecorder sets the recorder of events of persistent volumes. It must
+// be called before SetupScaleDriver, events are only logged by default.
+func (driver *ScaleDriver) SetEventRecorder(events VolumeEventRecorder) {
+	driver.events = events
+}
+
+// SetKubeClient keeps the state of the controller service in ConfigMaps of
+// namespace, shared by the driver instances of all nodes.
+func (driver *ScaleDriver) SetKubeClient(client kubernetes.Interface, namespace string) {
+	driver.kubeClient = client
+	driver.kubeNamespace = namespace
+}
+
+// newRecordStore returns the store of the record fileName of the controller
+// service. In the cluster, the record is kept in a ConfigMap named after the
+// driver and the record.
+func (driver *ScaleDriver) newRecordStore(fileName string) recordStore {
+	fileStore := newFileRecordStore(path.Join(PluginFolder, "controller"), fileName)
+	if driver.kubeClient == nil {
+		return fileStore
+	}
+	name := driver.name + "-" + strings.TrimSuffix(fileName, path.Ext(fileName))
+	return newConfigMapRecordStore(driver.kubeClient, driver.kubeNamespace, name, fileName, fileStore)
+}
+
 func (driver *ScaleDriver) SetupScaleDriver(name, vendorVersion, nodeID string) error {
 	glog.V(3).Infof("gpfs SetupScaleDriver. name: %s, version: %v, nodeID: %s", name, vendorVersion, nodeID)
 	if name == "" {
 		return fmt.Errorf("Driver name missing")
 	}
+	/* The driver name is recorded in the comment of the filesets it creates */
+	if len(name) > filesetCommentMaxDriverLen {
+		return fmt.Errorf("Driver name %s exceeds %d characters", name, filesetCommentMaxDriverLen)
+	}
+
+	if driver.configSource == nil {
+		driver.configSource = settings.FileConfigSource{Path: settings.ConfigMapFile}
+	}
+	if driver.events == nil {
+		driver.events = logEventRecorder{}
+	}
+	if err := driver.inodeExpansion.Validate(); err != nil {
+		return err
+	}
 
-	scmap, cmap, primary, err := driver.PluginInitialize()
+	scmap, cmap, primaries, err := driver.PluginInitialize()
 	if err != nil {
 		glog.Errorf("Error in plugin initialization: %s", err)
 		return err
@@ -155,29 +273,158 @@ func (driver *ScaleDriver) SetupScaleDriver(name, vendorVersion, nodeID string)
 	csc := []csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
 		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
 	}
 	_ = driver.AddControllerServiceCapabilities(csc)
 
+	gcsc := []csi.GroupControllerServiceCapability_RPC_Type{
+		csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+	}
+	_ = driver.AddGroupControllerServiceCapabilities(gcsc)
+
 	ns := []csi.NodeServiceCapability_RPC_Type{}
 	_ = driver.AddNodeServiceCapabilities(ns)
 	driver.ids = NewIdentityServer(driver)
 	driver.ns = NewNodeServer(driver)
-	driver.cs = NewControllerServer(driver, scmap, cmap, primary)
+	driver.cs = NewControllerServer(driver, scmap, cmap, primaries)
+	driver.gcs = NewGroupControllerServer(driver)
+
+	go driver.configSource.Watch(driver.ApplyScaleConfig, make(chan struct{}))
+	if driver.snapshotSchedulerInterval > 0 || driver.inodeExpansion.Interval > 0 {
+		go driver.runAsLeader(driver.runControllerTasks)
+	}
 	return nil
 }
 
-func (driver *ScaleDriver) PluginInitialize() (map[string]connectors.SpectrumScaleConnector, settings.ScaleSettingsConfigMap, settings.Primary, error) { //nolint:funlen
+// runControllerTasks runs the enabled background tasks of the controller
+// service until stop is closed.
+func (driver *ScaleDriver) runControllerTasks(stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	if driver.snapshotSchedulerInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			driver.cs.RunSnapshotScheduler(driver.snapshotSchedulerInterval, stop)
+		}()
+	}
+	if driver.inodeExpansion.Interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			driver.cs.RunInodeExpansion(driver.inodeExpansion, stop)
+		}()
+	}
+	wg.Wait()
+}
+
+// MigrateVolume migrates a fileset based volume to filesystem targetFs of
+// cluster targetClusterId and returns the new ID of the volume. It must be
+// called after SetupScaleDriver.
+func (driver *ScaleDriver) MigrateVolume(volumeID string, targetClusterId string, targetFs string) (string, error) {
+	return driver.cs.MigrateVolume(volumeID, targetClusterId, targetFs)
+}
+
+// ApplyScaleConfig applies changed credentials and CA certificates of the
+// clusters to their connectors, and changed policy templates to volumes
+// created afterwards. Other changes of the configuration require a restart of
+// the driver.
+func (driver *ScaleDriver) ApplyScaleConfig(scaleConfig settings.ScaleSettingsConfigMap) {
+	glog.V(3).Infof("gpfs ApplyScaleConfig")
+	driver.configMux.Lock()
+	defer driver.configMux.Unlock()
+
+	isValid, err := driver.ValidateScaleConfigParameters(scaleConfig)
+	if !isValid {
+		glog.Errorf("Invalid Spectrum Scale configuration, keeping previous configuration: %v", err)
+		return
+	}
+
+	changed := make(map[string]settings.Clusters)
+	for _, cluster := range scaleConfig.Clusters {
+		changed[cluster.ID] = cluster
+	}
+
+	/* Only credentials and policy templates are taken from the new configuration */
+	clusters := make([]settings.Clusters, len(driver.cmap.Clusters))
+	for i, cluster := range driver.cmap.Clusters {
+		clusters[i] = cluster
+		newCluster, ok := changed[cluster.ID]
+		conn, isConnPresent := driver.connmap[cluster.ID]
+		if !ok || !isConnPresent {
+			continue
+		}
+		if newCluster.MgmtUsername == cluster.MgmtUsername && newCluster.MgmtPassword == cluster.MgmtPassword && reflect.DeepEqual(newCluster.CacertValue, cluster.CacertValue) {
+			continue
+		}
+		/* The connector is updated with the startup configuration of the cluster */
+		cluster.MgmtUsername = newCluster.MgmtUsername
+		cluster.MgmtPassword = newCluster.MgmtPassword
+		cluster.CacertValue = newCluster.CacertValue
+		err = conn.UpdateCredentials(cluster)
+		if err != nil {
+			glog.Errorf("Unable to update credentials of cluster %s: %v", cluster.ID, err)
+			continue
+		}
+		clusters[i] = cluster
+		glog.Infof("Updated credentials of cluster %s", cluster.ID)
+	}
+
+	if !reflect.DeepEqual(withoutCredentials(scaleConfig), withoutCredentials(driver.cmap)) {
+		glog.Warningf("Spectrum Scale configuration changed, restart the driver to apply changes other than credentials, CA certificates and policy templates")
+	}
+	cmap := driver.cmap
+	cmap.Clusters = clusters
+	cmap.PolicyTemplates = scaleConfig.PolicyTemplates
+	driver.cmap = cmap
+}
+
+// GetPolicyTemplate returns the policy template named name in the configuration.
+func (driver *ScaleDriver) GetPolicyTemplate(name string) (settings.PolicyTemplate, bool) {
+	driver.configMux.Lock()
+	defer driver.configMux.Unlock()
+
+	for _, tpl := range driver.cmap.PolicyTemplates {
+		if tpl.Name == name {
+			return tpl, true
+		}
+	}
+	return settings.PolicyTemplate{}, false
+}
+
+// withoutCredentials returns a copy of the configuration without the
+// credentials and CA certificates of the clusters.
+func withoutCredentials(scaleConfig settings.ScaleSettingsConfigMap) settings.ScaleSettingsConfigMap {
+	clusters := make([]settings.Clusters, len(scaleConfig.Clusters))
+	for i, cluster := range scaleConfig.Clusters {
+		cluster.MgmtUsername = ""
+		cluster.MgmtPassword = ""
+		cluster.CacertValue = nil
+		clusters[i] = cluster
+	}
+	return settings.ScaleSettingsConfigMap{Clusters: clusters}
+}
+
+// PluginInitialize connects to the configured clusters and initializes all
+// primaries. The default primary is the primary without name, or the first
+// primary if all primaries are named.
+func (driver *ScaleDriver) PluginInitialize() (map[string]connectors.SpectrumScaleConnector, settings.ScaleSettingsConfigMap, []settings.Primary, error) { //nolint:funlen
 	glog.V(3).Infof("gpfs PluginInitialize")
-	scaleConfig := settings.LoadScaleConfigSettings()
+	scaleConfig, err := driver.configSource.Load()
+	if err != nil {
+		glog.Errorf("Unable to load Spectrum Scale configuration: %v", err)
+		return nil, settings.ScaleSettingsConfigMap{}, nil, err
+	}
 
 	isValid, err := driver.ValidateScaleConfigParameters(scaleConfig)
 	if !isValid {
 		glog.Errorf("Parameter validation failure")
-		return nil, settings.ScaleSettingsConfigMap{}, settings.Primary{}, err
+		return nil, settings.ScaleSettingsConfigMap{}, nil, err
 	}
 
 	scaleConnMap := make(map[string]connectors.SpectrumScaleConnector)
-	primaryInfo := settings.Primary{}
+	var primaries []settings.Primary
 
 	for i := 0; i < len(scaleConfig.Clusters); i++ {
 		cluster := scaleConfig.Clusters[i]
@@ -185,44 +432,80 @@ func (driver *ScaleDriver) PluginInitialize() (map[string]connectors.SpectrumSca
 		sc, err := connectors.GetSpectrumScaleConnector(cluster)
 		if err != nil {
 			glog.Errorf("Unable to initialize Spectrum Scale connector for cluster %s", cluster.ID)
-			return nil, scaleConfig, primaryInfo, err
+			return nil, scaleConfig, primaries, err
 		}
 
 		// validate cluster ID
 		clusterId, err := sc.GetClusterId()
 		if err != nil {
 			glog.Errorf("Error getting cluster ID: %v", err)
-			return nil, scaleConfig, primaryInfo, err
+			return nil, scaleConfig, primaries, err
 		}
 		if cluster.ID != clusterId {
 			glog.Errorf("Cluster ID %s from scale config doesnt match the ID from cluster %s.", cluster.ID, clusterId)
-			return nil, scaleConfig, primaryInfo, fmt.Errorf("Cluster ID doesnt match the cluster")
+			return nil, scaleConfig, primaries, fmt.Errorf("Cluster ID doesnt match the cluster")
 		}
 
 		scaleConnMap[clusterId] = sc
 
-		if cluster.Primary != (settings.Primary{}) {
-			scaleConnMap["primary"] = sc
-
+		for _, primary := range cluster.GetPrimaries() {
 			// check if primary filesystem exists and mounted on atleast one node
-			fsMount, err := sc.GetFilesystemMountDetails(cluster.Primary.GetPrimaryFs())
+			fsMount, err := sc.GetFilesystemMountDetails(primary.GetPrimaryFs())
 			if err != nil {
-				glog.Errorf("Error in getting filesystem details for %s", cluster.Primary.GetPrimaryFs())
-				return nil, scaleConfig, cluster.Primary, err
+				glog.Errorf("Error in getting filesystem details for %s", primary.GetPrimaryFs())
+				return nil, scaleConfig, primaries, err
 			}
 			if fsMount.NodesMounted == nil || len(fsMount.NodesMounted) == 0 {
-				return nil, scaleConfig, cluster.Primary, fmt.Errorf("Primary filesystem not mounted on any node")
+				return nil, scaleConfig, primaries, fmt.Errorf("Primary filesystem %s not mounted on any node", primary.GetPrimaryFs())
 			}
 
-			scaleConfig.Clusters[i].Primary.PrimaryFSMount = fsMount.MountPoint
-			scaleConfig.Clusters[i].Primary.PrimaryCid = clusterId
+			primary.PrimaryFSMount = fsMount.MountPoint
+			primary.PrimaryCid = clusterId
+
+			if primary.Name == "" {
+				primaries = append([]settings.Primary{primary}, primaries...)
+			} else {
+				primaries = append(primaries, primary)
+			}
+		}
+	}
+
+	scaleConnMap["primary"] = scaleConnMap[primaries[0].PrimaryCid]
+
+	// Load kubernetes node to Spectrum Scale node mapping
+	var primaryConns []connectors.SpectrumScaleConnector
+	for _, cid := range getPrimaryClusterIds(primaries) {
+		primaryConns = append(primaryConns, scaleConnMap[cid])
+	}
+	nodeMapper, err := settings.NewNodeMapper(settings.NodeMappingFile, func(mapping settings.NodeMapping) error {
+		return driver.ValidateNodeMapping(primaryConns, mapping)
+	})
+	if err != nil {
+		glog.Errorf("Error in loading node mapping: %v", err)
+		return scaleConnMap, scaleConfig, primaries, err
+	}
+	driver.nodeMapper = nodeMapper
+	go nodeMapper.Watch(settings.NodeMappingReloadInterval, make(chan struct{}))
 
-			primaryInfo = scaleConfig.Clusters[i].Primary
+	for i := range primaries {
+		primaries[i], err = driver.InitializePrimary(scaleConnMap, primaries[i])
+		if err != nil {
+			glog.Errorf("Error in initializing primary [%s] of cluster %s", primaries[i].Name, primaries[i].PrimaryCid)
+			return scaleConnMap, scaleConfig, primaries, err
 		}
 	}
 
+	glog.Infof("IBM Spectrum Scale: Plugin initialized")
+	return scaleConnMap, scaleConfig, primaries, nil
+}
+
+// InitializePrimary creates the primary fileset of a primary and the directory
+// where the volume symlinks of the primary reside.
+func (driver *ScaleDriver) InitializePrimary(scaleConnMap map[string]connectors.SpectrumScaleConnector, primaryInfo settings.Primary) (settings.Primary, error) {
+	glog.V(4).Infof("gpfs InitializePrimary. name: %s, cluster: %s", primaryInfo.Name, primaryInfo.PrimaryCid)
+
 	fs := primaryInfo.GetPrimaryFs()
-	sconn := scaleConnMap["primary"]
+	sconn := scaleConnMap[primaryInfo.PrimaryCid]
 	fsmount := primaryInfo.PrimaryFSMount
 	if primaryInfo.RemoteCluster != "" {
 		sconn = scaleConnMap[primaryInfo.RemoteCluster]
@@ -233,11 +516,11 @@ func (driver *ScaleDriver) PluginInitialize() (map[string]connectors.SpectrumSca
 			fsMount, err := sconn.GetFilesystemMountDetails(fs)
 			if err != nil {
 				glog.Errorf("Error in getting filesystem details for %s from cluster %s", fs, primaryInfo.RemoteCluster)
-				return scaleConnMap, scaleConfig, primaryInfo, err
+				return primaryInfo, err
 			}
 			glog.Infof("remote fsMount = %v", fsMount)
 			if fsMount.NodesMounted == nil || len(fsMount.NodesMounted) == 0 {
-				return scaleConnMap, scaleConfig, primaryInfo, fmt.Errorf("Primary filesystem not mounted on any node on cluster %s", primaryInfo.RemoteCluster)
+				return primaryInfo, fmt.Errorf("Primary filesystem not mounted on any node on cluster %s", primaryInfo.RemoteCluster)
 			}
 			fsmount = fsMount.MountPoint
 		}
@@ -246,7 +529,7 @@ func (driver *ScaleDriver) PluginInitialize() (map[string]connectors.SpectrumSca
 	fsetlinkpath, err := driver.CreatePrimaryFileset(sconn, fs, fsmount, primaryInfo.PrimaryFset, primaryInfo.GetInodeLimit())
 	if err != nil {
 		glog.Errorf("Error in creating primary fileset")
-		return scaleConnMap, scaleConfig, primaryInfo, err
+		return primaryInfo, err
 	}
 
 	if fsmount != primaryInfo.PrimaryFSMount {
@@ -257,21 +540,55 @@ func (driver *ScaleDriver) PluginInitialize() (map[string]connectors.SpectrumSca
 	err = driver.ValidateHostpath(primaryInfo.PrimaryFSMount, fsetlinkpath)
 	if err != nil {
 		glog.Errorf("Hostpath validation failed")
-		return scaleConnMap, scaleConfig, primaryInfo, err
+		return primaryInfo, err
 	}
 
 	// Create directory where volume symlinks will reside
-	symlinkPath, relativePath, err := driver.CreateSymlinkPath(scaleConnMap["primary"], primaryInfo.GetPrimaryFs(), primaryInfo.PrimaryFSMount, fsetlinkpath)
+	symlinkPath, relativePath, err := driver.CreateSymlinkPath(scaleConnMap[primaryInfo.PrimaryCid], primaryInfo.GetPrimaryFs(), primaryInfo.PrimaryFSMount, fsetlinkpath)
 	if err != nil {
 		glog.Errorf("Error in creating volumes directory")
-		return scaleConnMap, scaleConfig, primaryInfo, err
+		return primaryInfo, err
 	}
 	primaryInfo.SymlinkAbsolutePath = symlinkPath
 	primaryInfo.SymlinkRelativePath = relativePath
 	primaryInfo.PrimaryFsetLink = fsetlinkpath
+	return primaryInfo, nil
+}
 
-	glog.Infof("IBM Spectrum Scale: Plugin initialized")
-	return scaleConnMap, scaleConfig, primaryInfo, nil
+// GetPrimary returns the primary with the given name and the connector of its
+// cluster. An empty name selects the default primary.
+func (driver *ScaleDriver) GetPrimary(name string) (settings.Primary, connectors.SpectrumScaleConnector, error) {
+	primary := driver.primary
+	if name != "" && name != primary.Name {
+		found := false
+		for _, p := range driver.primaries {
+			if p.Name == name {
+				primary = p
+				found = true
+				break
+			}
+		}
+		if !found {
+			return settings.Primary{}, nil, fmt.Errorf("primary %s not defined in Spectrum Scale configuration", name)
+		}
+	}
+
+	conn, isConnPresent := driver.connmap[primary.PrimaryCid]
+	if !isConnPresent {
+		return settings.Primary{}, nil, fmt.Errorf("connector for cluster %s of primary %s not present", primary.PrimaryCid, primary.Name)
+	}
+	return primary, conn, nil
+}
+
+// getPrimaryClusterIds returns the IDs of the clusters with a primary.
+func getPrimaryClusterIds(primaries []settings.Primary) []string {
+	var cids []string
+	for _, primary := range primaries {
+		if !utils.StringInSlice(primary.PrimaryCid, cids) {
+			cids = append(cids, primary.PrimaryCid)
+		}
+	}
+	return cids
 }
 
 func (driver *ScaleDriver) CreatePrimaryFileset(sc connectors.SpectrumScaleConnector, primaryFS string, fsmount string, filesetName string, inodeLimit string) (string, error) {
@@ -321,7 +638,7 @@ func (driver *ScaleDriver) CreateSymlinkPath(sc connectors.SpectrumScaleConnecto
 	dirpath = fmt.Sprintf("%s/.volumes", dirpath)
 	symlinkpath := fmt.Sprintf("%s/.volumes", fsetlinkpath)
 
-	err := sc.MakeDirectory(fs, dirpath, "0", "0")
+	err := sc.MakeDirectory(fs, dirpath, "0", "0", "")
 	if err != nil {
 		glog.Errorf("Make directory failed on filesystem %s, path = %s", fs, dirpath)
 		return symlinkpath, dirpath, err
@@ -366,16 +683,20 @@ func (driver *ScaleDriver) ValidateHostpath(mountpath string, linkpath string) e
 	return nil
 }
 
-func (driver *ScaleDriver) ValidateScaleConfigParameters(scaleConfig settings.ScaleSettingsConfigMap) (bool, error) {
+func (driver *ScaleDriver) ValidateScaleConfigParameters(scaleConfig settings.ScaleSettingsConfigMap) (bool, error) { //nolint:gocyclo
 	glog.V(4).Infof("gpfs ValidateScaleConfigParameters.")
 	if len(scaleConfig.Clusters) == 0 {
 		return false, fmt.Errorf("Missing cluster information in Spectrum Scale configuration")
 	}
 
-	primaryClusterFound := false
-	rClusterForPrimaryFS := ""
+	primaryNames := make(map[string]bool)
+	primaryFsets := make(map[string]bool)
 	var cl []string = make([]string, len(scaleConfig.Clusters))
 
+	for i := 0; i < len(scaleConfig.Clusters); i++ {
+		cl[i] = scaleConfig.Clusters[i].ID
+	}
+
 	for i := 0; i < len(scaleConfig.Clusters); i++ {
 		cluster := scaleConfig.Clusters[i]
 
@@ -383,20 +704,33 @@ func (driver *ScaleDriver) ValidateScaleConfigParameters(scaleConfig settings.Sc
 			return false, fmt.Errorf("Mandatory parameters not specified for cluster %v", cluster.ID)
 		}
 
-		if cluster.Primary != (settings.Primary{}) {
-			if primaryClusterFound {
-				return false, fmt.Errorf("More than one primary clusters specified")
+		for _, primary := range cluster.GetPrimaries() {
+			if primaryNames[primary.Name] {
+				if primary.Name == "" {
+					return false, fmt.Errorf("More than one primary clusters specified without name")
+				}
+				return false, fmt.Errorf("More than one primary named %s specified", primary.Name)
+			}
+			primaryNames[primary.Name] = true
+
+			if strings.ContainsAny(primary.Name, ";=") {
+				return false, fmt.Errorf("Invalid name %s specified for primary of cluster %v", primary.Name, cluster.ID)
 			}
 
-			primaryClusterFound = true
+			if primary.GetPrimaryFs() == "" || primary.PrimaryFset == "" {
+				return false, fmt.Errorf("Mandatory parameters not specified for primary [%s] of cluster %v", primary.Name, cluster.ID)
+			}
 
-			if cluster.Primary.GetPrimaryFs() == "" || cluster.Primary.PrimaryFset == "" {
-				return false, fmt.Errorf("Mandatory parameters not specified for primary cluster %v", cluster.ID)
+			fsetKey := fmt.Sprintf("%s:%s:%s", cluster.ID, primary.GetPrimaryFs(), primary.PrimaryFset)
+			if primaryFsets[fsetKey] {
+				return false, fmt.Errorf("Primary fileset %s in filesystem %s of cluster %v specified for more than one primary", primary.PrimaryFset, primary.GetPrimaryFs(), cluster.ID)
 			}
+			primaryFsets[fsetKey] = true
 
-			rClusterForPrimaryFS = cluster.Primary.RemoteCluster
-		} else {
-			cl[i] = cluster.ID
+			rClusterForPrimaryFS := primary.RemoteCluster
+			if rClusterForPrimaryFS != "" && (rClusterForPrimaryFS == cluster.ID || !utils.StringInSlice(rClusterForPrimaryFS, cl)) {
+				return false, fmt.Errorf("Remote cluster specified for primary filesystem: %s, but no definition found for it in config", rClusterForPrimaryFS)
+			}
 		}
 
 		if cluster.Secrets == "" || cluster.MgmtUsername == "" || cluster.MgmtPassword == "" {
@@ -406,22 +740,98 @@ func (driver *ScaleDriver) ValidateScaleConfigParameters(scaleConfig settings.Sc
 		if cluster.SecureSslMode && cluster.CacertValue == nil {
 			return false, fmt.Errorf("CA certificate not specified in secure SSL mode for cluster %v", cluster.ID)
 		}
+
+		if err := validateQuotaGracePeriods(cluster); err != nil {
+			return false, err
+		}
 	}
 
-	if !primaryClusterFound {
+	if len(primaryNames) == 0 {
 		return false, fmt.Errorf("No primary clusters specified")
 	}
 
-	if rClusterForPrimaryFS != "" && !utils.StringInSlice(rClusterForPrimaryFS, cl) {
-		return false, fmt.Errorf("Remote cluster specified for primary filesystem: %s, but no definition found for it in config", rClusterForPrimaryFS)
+	if err := validatePolicyTemplates(scaleConfig.PolicyTemplates); err != nil {
+		return false, err
 	}
 
 	return true, nil
 }
 
+// validateQuotaGracePeriods checks the quota grace periods of the filesystems
+// of cluster.
+func validateQuotaGracePeriods(cluster settings.Clusters) error {
+	filesystems := make(map[string]bool)
+	for _, grace := range cluster.QuotaGracePeriods {
+		if grace.Filesystem == "" {
+			return fmt.Errorf("Filesystem not specified for quota grace periods of cluster %v", cluster.ID)
+		}
+		if filesystems[grace.Filesystem] {
+			return fmt.Errorf("Quota grace periods of filesystem %s of cluster %v specified more than once", grace.Filesystem, cluster.ID)
+		}
+		filesystems[grace.Filesystem] = true
+
+		if grace.BlockGracePeriod == "" && grace.FilesGracePeriod == "" {
+			return fmt.Errorf("No quota grace period specified for filesystem %s of cluster %v", grace.Filesystem, cluster.ID)
+		}
+		if grace.BlockGracePeriod != "" && !gracePeriodRegex.MatchString(grace.BlockGracePeriod) {
+			return fmt.Errorf("Invalid blockGracePeriod %q specified for filesystem %s of cluster %v, expected e.g. \"7 days\"", grace.BlockGracePeriod, grace.Filesystem, cluster.ID)
+		}
+		if grace.FilesGracePeriod != "" && !gracePeriodRegex.MatchString(grace.FilesGracePeriod) {
+			return fmt.Errorf("Invalid filesGracePeriod %q specified for filesystem %s of cluster %v, expected e.g. \"7 days\"", grace.FilesGracePeriod, grace.Filesystem, cluster.ID)
+		}
+	}
+	return nil
+}
+
+// GetQuotaGracePeriod returns the quota grace periods configured for
+// filesystem fsName of cluster clusterId.
+func (driver *ScaleDriver) GetQuotaGracePeriod(clusterId string, fsName string) settings.QuotaGracePeriod {
+	driver.configMux.Lock()
+	defer driver.configMux.Unlock()
+
+	for _, cluster := range driver.cmap.Clusters {
+		if cluster.ID != clusterId {
+			continue
+		}
+		for _, grace := range cluster.QuotaGracePeriods {
+			if grace.Filesystem == fsName {
+				return grace
+			}
+		}
+	}
+	return settings.QuotaGracePeriod{}
+}
+
+// ValidateNodeMapping checks that all explicitly mapped nodes are nodes of a primary cluster.
+func (driver *ScaleDriver) ValidateNodeMapping(primaryConns []connectors.SpectrumScaleConnector, mapping settings.NodeMapping) error {
+	glog.V(4).Infof("gpfs ValidateNodeMapping.")
+	if len(mapping.Nodes) == 0 {
+		return nil
+	}
+
+	var nodeNames []string
+	for _, sc := range primaryConns {
+		nodes, err := sc.ListNodes()
+		if err != nil {
+			return fmt.Errorf("Unable to list nodes of primary cluster: %v", err)
+		}
+
+		for _, node := range nodes {
+			nodeNames = append(nodeNames, node.AdminNodename, node.Network.DaemonNodeName)
+		}
+	}
+
+	for k8sNode, scaleNode := range mapping.Nodes {
+		if !utils.StringInSlice(scaleNode, nodeNames) {
+			return fmt.Errorf("Node %s mapped for kubernetes node %s is not a node of a primary cluster", scaleNode, k8sNode)
+		}
+	}
+	return nil
+}
+
 func (driver *ScaleDriver) Run(endpoint string) {
 	glog.Infof("Driver: %v version: %v", driver.name, driver.vendorVersion)
 	s := NewNonBlockingGRPCServer()
-	s.Start(endpoint, driver.ids, driver.cs, driver.ns)
+	s.Start(endpoint, driver.ids, driver.cs, driver.gcs, driver.ns)
 	s.Wait()
 }
@@ -18,12 +18,23 @@ package scale
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
+	"time"
 
 	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/connectors"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/utils"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/volumeid"
 	"github.com/golang/glog"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -32,8 +43,133 @@ import (
 const (
 	dependentFileset   = "dependent"
 	independentFileset = "independent"
+
+	// Spectrum Scale has no directory quotas, so the capacity of directory
+	// based volumes is only enforced for fileset based volumes.
+	quotaEnforcementNone   = "none"
+	quotaEnforcementStrict = "strict"
+
+	// AFM cache modes of fileset based volumes
+	afmModeReadOnly          = "ro"
+	afmModeLocalUpdate       = "lu"
+	afmModeSingleWriter      = "sw"
+	afmModeIndependentWriter = "iw"
+
+	// Integrated archive modes of fileset based volumes
+	iamModeAdvisory     = "advisory"
+	iamModeNonCompliant = "noncompliant"
+	iamModeCompliant    = "compliant"
+
+	// PVC metadata passed by the external-provisioner with --extra-create-metadata
+	pvcNameKey      = "csi.storage.k8s.io/pvc/name"
+	pvcNamespaceKey = "csi.storage.k8s.io/pvc/namespace"
+	pvNameKey       = "csi.storage.k8s.io/pv/name"
+
+	// Volume context keys carrying the resolved backend details of a volume,
+	// prefixed to not collide with storageClass parameters
+	volCtxKeyPrefix    = "spectrumscale.csi.ibm.com/"
+	volCtxFsName       = volCtxKeyPrefix + "fsName"
+	volCtxFsMountPoint = volCtxKeyPrefix + "fsMountPoint"
+	volCtxFilesetName  = volCtxKeyPrefix + "filesetName"
+	volCtxVolumeType   = volCtxKeyPrefix + "volumeType"
+	volCtxDataPath     = volCtxKeyPrefix + "dataPath"
+	volCtxAfmMode      = volCtxKeyPrefix + "afmMode"
+	volCtxAfmTarget    = volCtxKeyPrefix + "afmTarget"
+	volCtxNfsExport    = volCtxKeyPrefix + "nfsExportLocation"
+
+	// CES service which must be enabled for NFS exports
+	cesServiceNfs = "NFS"
+
+	filesetNameMaxLen  = 255
+	filesetNameHashLen = 8
+
+	// Topology segment keys published by the node plugin
+	topologyKeyPrefix  = "spectrumscale.csi.ibm.com/"
+	topologyKeyCluster = topologyKeyPrefix + "cluster"
+	topologyKeyFsPfx   = topologyKeyPrefix + "fs-"
+	topologyFsMounted  = "true"
 )
 
+// A topology key name must be a valid kubernetes label name (max 63 chars).
+var topologyFsNameRegex = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]{0,56}[A-Za-z0-9])?$`)
+
+var mountOptionRegex = regexp.MustCompile(`^[A-Za-z0-9_]+(=[-A-Za-z0-9_.:/]+)?$`)
+
+var filesetNameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// filesetNameParams are the fields available in a fileset name template.
+type filesetNameParams struct {
+	Namespace string
+	PVCName   string
+	PVName    string
+}
+
+// afmModes maps the AFM modes accepted in a storageClass, and reported by the
+// GUI, to their short names.
+var afmModes = map[string]string{
+	afmModeReadOnly:          afmModeReadOnly,
+	"read-only":              afmModeReadOnly,
+	afmModeLocalUpdate:       afmModeLocalUpdate,
+	"local-updates":          afmModeLocalUpdate,
+	"local-update":           afmModeLocalUpdate,
+	afmModeSingleWriter:      afmModeSingleWriter,
+	"single-writer":          afmModeSingleWriter,
+	afmModeIndependentWriter: afmModeIndependentWriter,
+	"independent-writer":     afmModeIndependentWriter,
+}
+
+// iamModes maps the integrated archive modes accepted in a storageClass, and
+// reported by the GUI, to their long names. Filesets without IAM mode are
+// reported as "off".
+var iamModes = map[string]string{
+	"off":               "",
+	"ad":                iamModeAdvisory,
+	iamModeAdvisory:     iamModeAdvisory,
+	"nc":                iamModeNonCompliant,
+	iamModeNonCompliant: iamModeNonCompliant,
+	"co":                iamModeCompliant,
+	iamModeCompliant:    iamModeCompliant,
+}
+
+var permissionChangeModes = []string{"chmodOnly", "setAclOnly", "chmodAndSetAcl", "chmodAndUpdateAcl"}
+
+var permissionsRegex = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+var aclEntryTypes = []string{"allow", "deny", "alarm", "audit"}
+
+var aclWhoRegex = regexp.MustCompile(`^(special:(owner|group|everyone)@|(user|group):[^:,\s]+)$`)
+
+var aclPermissionsRegex = regexp.MustCompile(`^[A-Za-z]+$`)
+
+var aclFlagsRegex = regexp.MustCompile(`^[A-Za-z]*$`)
+
+// A CES NFS client is a host, network or "*", optionally followed by its
+// export options, e.g. "10.0.0.0/24(Access_Type=RW,Squash=root_squash)".
+var nfsClientRegex = regexp.MustCompile(`^[^\s();]+(\([^();]*\))?$`)
+
+var retentionPeriodRegex = regexp.MustCompile(`(?i)^([0-9]+) ?days?$`)
+
+// The home of an AFM cache is an NFS export or a path in a remote filesystem.
+var afmTargetRegex = regexp.MustCompile(`^(nfs://[-A-Za-z0-9_.:\[\]]+/|gpfs:///)[^;\s]+$`)
+
+// An encryption key is referenced as <key id>:<RKM id> of the RKM.conf stanza
+// of its key server.
+var encryptionKeyRegex = regexp.MustCompile(`^[-A-Za-z0-9_.]+:[-A-Za-z0-9_.]+$`)
+
+// The encryption algorithm is a default such as DEFAULTNISTSP800131A or an
+// explicit combination like AES:256:XTS:FEK:HMACSHA512.
+var encryptionAlgorithmRegex = regexp.MustCompile(`^[A-Za-z0-9]+(:[A-Za-z0-9]+)*$`)
+
+const defaultEncryptionAlgorithm = "DEFAULTNISTSP800131A"
+
+var gracePeriodRegex = regexp.MustCompile(`(?i)^[0-9]+ ?(days?|hours?|minutes?|seconds?)$`)
+
+// Mount options which must not be used together
+var conflictingMountOptions = map[string]string{
+	"ro": "rw",
+	"rw": "ro",
+}
+
 type scaleVolume struct {
 	VolName            string                            `json:"volName"`
 	VolSize            uint64                            `json:"volSize"`
@@ -53,15 +189,35 @@ type scaleVolume struct {
 	PrimaryFSMount     string                            `json:"primaryFSMount"`
 	ParentFileset      string                            `json:"parentFileset"`
 	LocalFS            string                            `json:"localFS"`
-}
-
-type scaleVolId struct {
-	ClusterId      string
-	FsUUID         string
-	FsetId         string
-	DirPath        string
-	SymLnkPath     string
-	IsFilesetBased bool
+	MountOptions       string                            `json:"mountOptions"`
+	StoragePool        string                            `json:"storagePool"`
+	FilesHardLimit     string                            `json:"filesHardLimit"`
+	FilesSoftLimit     string                            `json:"filesSoftLimit"`
+	BlockSoftLimitPc   uint64                            `json:"blockSoftLimitPercent"`
+	BlockGracePeriod   string                            `json:"blockGracePeriod"`
+	FilesGracePeriod   string                            `json:"filesGracePeriod"`
+	QuotaEnforcement   string                            `json:"quotaEnforcement"`
+	FilesetName        string                            `json:"filesetName"`
+	FilesetNameTpl     string                            `json:"filesetNameTemplate"`
+	PVCName            string                            `json:"pvcName"`
+	PVCNamespace       string                            `json:"pvcNamespace"`
+	PathMode           string                            `json:"volumePathMode"`
+	PrimaryName        string                            `json:"primaryName"`
+	AfmMode            string                            `json:"afmMode"`
+	AfmTarget          string                            `json:"afmTarget"`
+	AfmAsyncDelay      string                            `json:"afmAsyncDelay"`
+	IamMode            string                            `json:"iamMode"`
+	RetentionDays      uint64                            `json:"retentionDays"`
+	PermChangeMode     string                            `json:"permissionChangeMode"`
+	Permissions        string                            `json:"permissions"`
+	NFSv4Acl           []connectors.ACLEntry             `json:"nfsv4Acl"`
+	NfsClients         []string                          `json:"nfsClients"`
+	NfsExportPath      string                            `json:"nfsExportPath"`
+	NfsExportLocation  string                            `json:"nfsExportLocation"`
+	SnapshotSchedule   string                            `json:"snapshotSchedule"`
+	EncryptionKeys     []string                          `json:"encryptionKeys"`
+	EncryptionAlgo     string                            `json:"encryptionAlgorithm"`
+	PolicyTemplates    []string                          `json:"policyTemplates"`
 }
 
 func getScaleVolumeOptions(volOptions map[string]string) (*scaleVolume, error) { //nolint:gocyclo,funlen
@@ -76,6 +232,7 @@ func getScaleVolumeOptions(volOptions map[string]string) (*scaleVolume, error) {
 	fsType, fsTypeSpecified := volOptions[connectors.UserSpecifiedFilesetType]
 	inodeLim, inodeLimSpecified := volOptions[connectors.UserSpecifiedInodeLimit]
 	parentFileset, isparentFilesetSpecified := volOptions[connectors.UserSpecifiedParentFset]
+	storagePool, storagePoolSpecified := volOptions[connectors.UserSpecifiedStoragePool]
 
 	// Handling empty values
 	scaleVol.VolDirBasePath = ""
@@ -83,6 +240,98 @@ func getScaleVolumeOptions(volOptions map[string]string) (*scaleVolume, error) {
 	scaleVol.FilesetType = ""
 	scaleVol.ClusterId = ""
 
+	if mountOpts, mountOptsSpecified := volOptions[connectors.UserSpecifiedMountOptions]; mountOptsSpecified {
+		opts, err := parseMountOptions(mountOpts)
+		if err != nil {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid value specified for mountOptions in storageClass: %v", err))
+		}
+		scaleVol.MountOptions = opts
+	}
+
+	err := getQuotaOptions(scaleVol, volOptions)
+	if err != nil {
+		return &scaleVolume{}, err
+	}
+
+	err = getAfmOptions(scaleVol, volOptions)
+	if err != nil {
+		return &scaleVolume{}, err
+	}
+
+	err = getIamOptions(scaleVol, volOptions)
+	if err != nil {
+		return &scaleVolume{}, err
+	}
+
+	err = getPermissionOptions(scaleVol, volOptions)
+	if err != nil {
+		return &scaleVolume{}, err
+	}
+
+	err = getEncryptionOptions(scaleVol, volOptions)
+	if err != nil {
+		return &scaleVolume{}, err
+	}
+
+	if templates := volOptions[connectors.UserSpecifiedPolicyTemplate]; templates != "" {
+		for _, name := range strings.Split(templates, ",") {
+			name = strings.TrimSpace(name)
+			if !policyTemplateNameRegex.MatchString(name) {
+				return &scaleVolume{}, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid template name %q specified in policyTemplate in storageClass", name))
+			}
+			scaleVol.PolicyTemplates = append(scaleVol.PolicyTemplates, name)
+		}
+	}
+
+	if nfsExport := volOptions[connectors.UserSpecifiedNfsExport]; nfsExport != "" {
+		clients, err := parseNfsClients(nfsExport)
+		if err != nil {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid value specified for nfsExport in storageClass: %v", err))
+		}
+		scaleVol.NfsClients = clients
+	}
+
+	if schedule := volOptions[connectors.UserSpecifiedSnapSchedule]; schedule != "" {
+		_, err := parseSnapshotSchedule(schedule)
+		if err != nil {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid value specified for snapshotSchedule in storageClass: %v", err))
+		}
+		/* The schedule is recorded in the fileset comment */
+		if len(schedule) > filesetCommentMaxScheduleLen {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, fmt.Sprintf("snapshotSchedule specified in storageClass must not exceed %d characters", filesetCommentMaxScheduleLen))
+		}
+		scaleVol.SnapshotSchedule = schedule
+	}
+
+	scaleVol.PVCName = volOptions[pvcNameKey]
+	scaleVol.PVCNamespace = volOptions[pvcNamespaceKey]
+
+	if tpl := volOptions[connectors.UserSpecifiedFsetNameTpl]; tpl != "" {
+		_, err := template.New("filesetName").Parse(tpl)
+		if err != nil {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid filesetNameTemplate specified in storageClass: %v", err))
+		}
+		scaleVol.FilesetNameTpl = tpl
+	}
+
+	scaleVol.QuotaEnforcement = quotaEnforcementNone
+	if enforcement := volOptions[connectors.UserSpecifiedQuotaEnforce]; enforcement != "" {
+		if enforcement != quotaEnforcementNone && enforcement != quotaEnforcementStrict {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "Invalid value specified for quotaEnforcement in storageClass, valid values are \"none\" and \"strict\"")
+		}
+		scaleVol.QuotaEnforcement = enforcement
+	}
+
+	scaleVol.PrimaryName = volOptions[connectors.UserSpecifiedPrimaryName]
+
+	scaleVol.PathMode = volumeid.PathModeSymlink
+	if pathMode := volOptions[connectors.UserSpecifiedVolPathMode]; pathMode != "" {
+		if pathMode != volumeid.PathModeSymlink && pathMode != volumeid.PathModeDirect {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "Invalid value specified for volumePathMode in storageClass, valid values are \"symlink\" and \"direct\"")
+		}
+		scaleVol.PathMode = pathMode
+	}
+
 	if fsSpecified && volBckFs == "" {
 		fsSpecified = false
 	}
@@ -131,6 +380,10 @@ func getScaleVolumeOptions(volOptions map[string]string) (*scaleVolume, error) {
 		isparentFilesetSpecified = false
 	}
 
+	if storagePoolSpecified && storagePool == "" {
+		storagePoolSpecified = false
+	}
+
 	if volDirPathSpecified {
 		if fsTypeSpecified {
 			return &scaleVolume{}, status.Error(codes.InvalidArgument, "fileType and volDirBasePath must not be specified together in storageClass")
@@ -141,6 +394,33 @@ func getScaleVolumeOptions(volOptions map[string]string) (*scaleVolume, error) {
 		if inodeLimSpecified {
 			return &scaleVolume{}, status.Error(codes.InvalidArgument, "inodeLimit and volDirBasePath must not be specified together in storageClass")
 		}
+		if storagePoolSpecified {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "storagePool and volDirBasePath must not be specified together in storageClass")
+		}
+		if scaleVol.FilesetNameTpl != "" {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "filesetNameTemplate and volDirBasePath must not be specified together in storageClass")
+		}
+		if scaleVol.hasQuotaOptions() {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "quota limits must not be specified together with volDirBasePath in storageClass")
+		}
+		if scaleVol.isAfmCache() {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "afmMode and volDirBasePath must not be specified together in storageClass")
+		}
+		if scaleVol.IamMode != "" {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "iamMode and volDirBasePath must not be specified together in storageClass")
+		}
+		if scaleVol.PermChangeMode != "" {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "permissionChangeMode and volDirBasePath must not be specified together in storageClass")
+		}
+		if scaleVol.SnapshotSchedule != "" {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "snapshotSchedule and volDirBasePath must not be specified together in storageClass")
+		}
+		if len(scaleVol.EncryptionKeys) != 0 {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "encryptionKey and volDirBasePath must not be specified together in storageClass")
+		}
+		if len(scaleVol.PolicyTemplates) != 0 {
+			return &scaleVolume{}, status.Error(codes.InvalidArgument, "policyTemplate and volDirBasePath must not be specified together in storageClass")
+		}
 	}
 
 	if fsTypeSpecified {
@@ -148,6 +428,15 @@ func getScaleVolumeOptions(volOptions map[string]string) (*scaleVolume, error) {
 			if inodeLimSpecified {
 				return &scaleVolume{}, status.Error(codes.InvalidArgument, "inodeLimit and fileseType=dependent must not be specified together in storageClass")
 			}
+			if scaleVol.isAfmCache() {
+				return &scaleVolume{}, status.Error(codes.InvalidArgument, "afmMode and fileseType=dependent must not be specified together in storageClass, AFM cache filesets are independent filesets")
+			}
+			if scaleVol.IamMode != "" {
+				return &scaleVolume{}, status.Error(codes.InvalidArgument, "iamMode and fileseType=dependent must not be specified together in storageClass, IAM modes can only be set for independent filesets")
+			}
+			if scaleVol.SnapshotSchedule != "" {
+				return &scaleVolume{}, status.Error(codes.InvalidArgument, "snapshotSchedule and fileseType=dependent must not be specified together in storageClass, snapshots are taken of independent filesets")
+			}
 		} else if fsType == independentFileset {
 			if isparentFilesetSpecified {
 				return &scaleVolume{}, status.Error(codes.InvalidArgument, "parentFileset and fileseType=independent(Default) must not be specified together in storageClass")
@@ -187,6 +476,11 @@ func getScaleVolumeOptions(volOptions map[string]string) (*scaleVolume, error) {
 		}
 	}
 
+	/* The root directory of a read-only cache can not be changed */
+	if scaleVol.AfmMode == afmModeReadOnly && (uidSpecified || scaleVol.Permissions != "" || len(scaleVol.NFSv4Acl) != 0) {
+		return &scaleVolume{}, status.Error(codes.InvalidArgument, "uid, gid, permissions and nfsv4Acl must not be specified together with afmMode=ro in storageClass")
+	}
+
 	/* Get UID/GID */
 	if uidSpecified {
 		scaleVol.VolUid = uid
@@ -206,10 +500,495 @@ func getScaleVolumeOptions(volOptions map[string]string) (*scaleVolume, error) {
 		if inodeLimSpecified {
 			scaleVol.InodeLimit = inodeLim
 		}
+		if storagePoolSpecified {
+			scaleVol.StoragePool = storagePool
+		}
 	}
 	return scaleVol, nil
 }
 
+// getQuotaOptions validates the fileset quota parameters of a storageClass.
+func getQuotaOptions(scaleVol *scaleVolume, volOptions map[string]string) error { //nolint:gocyclo
+	scaleVol.BlockSoftLimitPc = 100
+	if pc := volOptions[connectors.UserSpecifiedBlockSoftLimitPc]; pc != "" {
+		softLimitPc, err := strconv.ParseUint(pc, 10, 64)
+		if err != nil || softLimitPc < 1 || softLimitPc > 100 {
+			return status.Error(codes.InvalidArgument, "blockSoftLimitPercent specified in storageClass must be a number between 1 and 100")
+		}
+		scaleVol.BlockSoftLimitPc = softLimitPc
+	}
+
+	var filesHardLimit, filesSoftLimit uint64
+	var err error
+	if limit := volOptions[connectors.UserSpecifiedFilesHardLimit]; limit != "" {
+		filesHardLimit, err = strconv.ParseUint(limit, 10, 64)
+		if err != nil || filesHardLimit == 0 {
+			return status.Error(codes.InvalidArgument, "Invalid value specified for filesHardLimit in storageClass")
+		}
+		scaleVol.FilesHardLimit = limit
+	}
+	if limit := volOptions[connectors.UserSpecifiedFilesSoftLimit]; limit != "" {
+		filesSoftLimit, err = strconv.ParseUint(limit, 10, 64)
+		if err != nil || filesSoftLimit == 0 {
+			return status.Error(codes.InvalidArgument, "Invalid value specified for filesSoftLimit in storageClass")
+		}
+		scaleVol.FilesSoftLimit = limit
+	}
+	if filesHardLimit != 0 && filesSoftLimit > filesHardLimit {
+		return status.Error(codes.InvalidArgument, "filesSoftLimit must not be greater than filesHardLimit in storageClass")
+	}
+
+	/* Grace periods apply to all fileset quotas of a filesystem, storageClasses must not change them */
+	for _, key := range []string{connectors.UserSpecifiedBlockGracePeriod, connectors.UserSpecifiedFilesGracePeriod} {
+		if _, ok := volOptions[key]; ok {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("%s must not be specified in storageClass, grace periods apply to the whole filesystem and are set with quotaGracePeriods of the cluster in the driver configuration", key))
+		}
+	}
+	return nil
+}
+
+// getAfmOptions validates the AFM cache parameters of a storageClass.
+func getAfmOptions(scaleVol *scaleVolume, volOptions map[string]string) error {
+	mode := volOptions[connectors.UserSpecifiedAfmMode]
+	target := volOptions[connectors.UserSpecifiedAfmTarget]
+	asyncDelay := volOptions[connectors.UserSpecifiedAfmAsyncDelay]
+
+	if mode == "" {
+		if target != "" || asyncDelay != "" {
+			return status.Error(codes.InvalidArgument, "afmTarget and afmAsyncDelay require afmMode in storageClass")
+		}
+		return nil
+	}
+
+	afmMode, ok := afmModes[strings.ToLower(mode)]
+	if !ok {
+		return status.Error(codes.InvalidArgument, "Invalid value specified for afmMode in storageClass, valid values are \"ro\", \"lu\", \"sw\" and \"iw\"")
+	}
+	if target == "" {
+		return status.Error(codes.InvalidArgument, "afmTarget must be specified in storageClass together with afmMode")
+	}
+	if !afmTargetRegex.MatchString(target) {
+		return status.Error(codes.InvalidArgument, "Invalid value specified for afmTarget in storageClass, expected e.g. \"nfs://homeserver/gpfs/fs1/export\" or \"gpfs:///remotefs/export\"")
+	}
+	if asyncDelay != "" {
+		if afmMode != afmModeSingleWriter && afmMode != afmModeIndependentWriter {
+			return status.Error(codes.InvalidArgument, "afmAsyncDelay can only be specified together with afmMode \"sw\" or \"iw\" in storageClass")
+		}
+		delay, err := strconv.ParseUint(asyncDelay, 10, 31)
+		if err != nil || delay == 0 {
+			return status.Error(codes.InvalidArgument, "afmAsyncDelay specified in storageClass must be a number of seconds greater than 0")
+		}
+	}
+
+	scaleVol.AfmMode = afmMode
+	scaleVol.AfmTarget = target
+	scaleVol.AfmAsyncDelay = asyncDelay
+	return nil
+}
+
+// getIamOptions validates the integrated archive mode parameters of a storageClass.
+// The retention period is only recorded in the fileset comment, Spectrum Scale
+// has no default retention of filesets.
+func getIamOptions(scaleVol *scaleVolume, volOptions map[string]string) error {
+	mode := volOptions[connectors.UserSpecifiedIamMode]
+	retention := volOptions[connectors.UserSpecifiedRetention]
+
+	if mode == "" {
+		if retention != "" {
+			return status.Error(codes.InvalidArgument, "retentionPeriodInfo requires iamMode in storageClass")
+		}
+		return nil
+	}
+
+	iamMode, ok := iamModes[strings.ToLower(mode)]
+	if !ok || iamMode == "" {
+		return status.Error(codes.InvalidArgument, "Invalid value specified for iamMode in storageClass, valid values are \"advisory\", \"noncompliant\" and \"compliant\"")
+	}
+	if scaleVol.isAfmCache() {
+		return status.Error(codes.InvalidArgument, "iamMode and afmMode must not be specified together in storageClass")
+	}
+	if retention != "" {
+		match := retentionPeriodRegex.FindStringSubmatch(retention)
+		if match == nil {
+			return status.Error(codes.InvalidArgument, "Invalid value specified for retentionPeriodInfo in storageClass, expected e.g. \"365 days\"")
+		}
+		days, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || days == 0 {
+			return status.Error(codes.InvalidArgument, "retentionPeriodInfo specified in storageClass must be at least 1 day")
+		}
+		scaleVol.RetentionDays = days
+	}
+
+	scaleVol.IamMode = iamMode
+	return nil
+}
+
+// getEncryptionOptions validates the encryption parameters of a storageClass.
+// encryptionKey is a comma separated list of keys, files are encrypted with
+// all of them.
+func getEncryptionOptions(scaleVol *scaleVolume, volOptions map[string]string) error {
+	keys := volOptions[connectors.UserSpecifiedEncryptionKey]
+	algo := volOptions[connectors.UserSpecifiedEncryptionAlgo]
+
+	if keys == "" {
+		if algo != "" {
+			return status.Error(codes.InvalidArgument, "encryptionAlgorithm requires encryptionKey in storageClass")
+		}
+		return nil
+	}
+
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if !encryptionKeyRegex.MatchString(key) {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid key %q specified in encryptionKey in storageClass, expected <key id>:<RKM id>", key))
+		}
+		scaleVol.EncryptionKeys = append(scaleVol.EncryptionKeys, key)
+	}
+
+	scaleVol.EncryptionAlgo = defaultEncryptionAlgorithm
+	if algo != "" {
+		if !encryptionAlgorithmRegex.MatchString(algo) {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid value specified for encryptionAlgorithm in storageClass, expected e.g. %q or \"AES:256:XTS:FEK:HMACSHA512\"", defaultEncryptionAlgorithm))
+		}
+		scaleVol.EncryptionAlgo = strings.ToUpper(algo)
+	}
+	return nil
+}
+
+// getPermissionOptions validates the permission parameters of a storageClass.
+func getPermissionOptions(scaleVol *scaleVolume, volOptions map[string]string) error {
+	if mode := volOptions[connectors.UserSpecifiedPermChangeMode]; mode != "" {
+		if !utils.StringInSlice(mode, permissionChangeModes) {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid value specified for permissionChangeMode in storageClass, valid values are %s", strings.Join(permissionChangeModes, ", ")))
+		}
+		scaleVol.PermChangeMode = mode
+	}
+
+	if permissions := volOptions[connectors.UserSpecifiedPermissions]; permissions != "" {
+		if !permissionsRegex.MatchString(permissions) {
+			return status.Error(codes.InvalidArgument, "Invalid value specified for permissions in storageClass, expected an octal mode e.g. \"0770\"")
+		}
+		scaleVol.Permissions = permissions
+	}
+
+	if acl := volOptions[connectors.UserSpecifiedNFSv4Acl]; acl != "" {
+		entries, err := parseNFSv4Acl(acl)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("Invalid value specified for nfsv4Acl in storageClass: %v", err))
+		}
+		scaleVol.NFSv4Acl = entries
+	}
+	return nil
+}
+
+// parseNFSv4Acl parses a comma separated list of NFSv4 ACL entries of the form
+// <type>:<who>:<permissions>[:<flags>], e.g. "allow:special:owner@:rwmxDaAnNcCos:fd".
+func parseNFSv4Acl(acl string) ([]connectors.ACLEntry, error) {
+	entries := []connectors.ACLEntry{}
+	for _, entry := range strings.Split(acl, ",") {
+		entry = strings.TrimSpace(entry)
+		fields := strings.Split(entry, ":")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("entry %q must have the form <type>:<who>:<permissions>[:<flags>]", entry)
+		}
+
+		/* who contains a colon, permissions and flags follow it */
+		aclEntry := connectors.ACLEntry{Type: fields[0]}
+		whoFields := fields[1:3]
+		rest := fields[3:]
+		if len(rest) > 2 {
+			return nil, fmt.Errorf("entry %q has too many fields", entry)
+		}
+		aclEntry.Who = strings.Join(whoFields, ":")
+		aclEntry.Permissions = rest[0]
+		if len(rest) == 2 {
+			aclEntry.Flags = rest[1]
+		}
+
+		if !utils.StringInSlice(aclEntry.Type, aclEntryTypes) {
+			return nil, fmt.Errorf("invalid type %q in entry %q, valid types are %s", aclEntry.Type, entry, strings.Join(aclEntryTypes, ", "))
+		}
+		if !aclWhoRegex.MatchString(aclEntry.Who) {
+			return nil, fmt.Errorf("invalid who %q in entry %q, expected special:owner@, special:group@, special:everyone@, user:<name> or group:<name>", aclEntry.Who, entry)
+		}
+		if !aclPermissionsRegex.MatchString(aclEntry.Permissions) {
+			return nil, fmt.Errorf("invalid permissions %q in entry %q", aclEntry.Permissions, entry)
+		}
+		if !aclFlagsRegex.MatchString(aclEntry.Flags) {
+			return nil, fmt.Errorf("invalid flags %q in entry %q", aclEntry.Flags, entry)
+		}
+		entries = append(entries, aclEntry)
+	}
+	return entries, nil
+}
+
+// parseNfsClients parses a ";" separated list of CES NFS client definitions.
+func parseNfsClients(nfsExport string) ([]string, error) {
+	clients := []string{}
+	for _, client := range strings.Split(nfsExport, ";") {
+		client = strings.TrimSpace(client)
+		if client == "" {
+			continue
+		}
+		if !nfsClientRegex.MatchString(client) {
+			return nil, fmt.Errorf("invalid client %q, expected e.g. \"10.0.0.0/24(Access_Type=RW,Squash=root_squash)\"", client)
+		}
+		clients = append(clients, client)
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("no client specified")
+	}
+	return clients, nil
+}
+
+// isImmutable returns true for IAM modes in which files under retention can
+// not be deleted, not even by root.
+func isImmutable(iamMode string) bool {
+	return iamMode == iamModeNonCompliant || iamMode == iamModeCompliant
+}
+
+// isRetentionError returns true if Spectrum Scale refused to delete files
+// because they are immutable or under retention.
+func isRetentionError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, reason := range []string{"operation not permitted", "immutable", "retention", "append-only"} {
+		if strings.Contains(msg, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// findRetainedFile returns the first file below dataPath that is under
+// retention, i.e. read-only with an access time in the future, or "" if no
+// file is retained. Nothing is modified.
+func findRetainedFile(dataPath string, now time.Time) (string, error) {
+	/* Walk does not follow the symlink of a volume in symlink mode */
+	resolvedPath, err := filepath.EvalSymlinks(dataPath)
+	if err != nil {
+		return "", err
+	}
+	retained := ""
+	err = filepath.Walk(resolvedPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Mode().Perm()&0222 != 0 {
+			return nil
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("unable to get access time of %s", filePath)
+		}
+		if time.Unix(stat.Atim.Sec, stat.Atim.Nsec).After(now) {
+			retained = filePath
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return retained, nil
+}
+
+// checkFilesetIamMode verifies that the IAM mode of an existing fileset
+// matches the requested mode.
+func checkFilesetIamMode(scVol *scaleVolume, fileset connectors.Fileset_v2) error {
+	mode, ok := iamModes[strings.ToLower(fileset.Config.IamMode)]
+	if !ok && fileset.Config.IamMode != "" {
+		mode = fileset.Config.IamMode
+	}
+	if mode != scVol.IamMode {
+		return status.Error(codes.AlreadyExists, fmt.Sprintf("Fileset %v present but IAM mode [%v] does not match with requested mode [%v]", scVol.FilesetName, fileset.Config.IamMode, scVol.IamMode))
+	}
+	return nil
+}
+
+// isAfmCache returns true if the fileset of the volume is an AFM cache.
+func (scaleVol *scaleVolume) isAfmCache() bool {
+	return scaleVol.AfmMode != ""
+}
+
+// checkFilesetAfm verifies that the AFM settings of an existing fileset match
+// the requested settings.
+func checkFilesetAfm(scVol *scaleVolume, fileset connectors.Fileset_v2) error {
+	mode := afmModes[strings.ToLower(fileset.AFM.AFMMode)]
+	if mode != scVol.AfmMode {
+		return status.Error(codes.AlreadyExists, fmt.Sprintf("Fileset %v present but AFM mode [%v] does not match with requested mode [%v]", scVol.FilesetName, fileset.AFM.AFMMode, scVol.AfmMode))
+	}
+	if scVol.isAfmCache() && strings.TrimRight(fileset.AFM.AFMTarget, "/") != strings.TrimRight(scVol.AfmTarget, "/") {
+		return status.Error(codes.AlreadyExists, fmt.Sprintf("Fileset %v present but AFM target [%v] does not match with requested target [%v]", scVol.FilesetName, fileset.AFM.AFMTarget, scVol.AfmTarget))
+	}
+	return nil
+}
+
+func (scaleVol *scaleVolume) hasQuotaOptions() bool {
+	return scaleVol.FilesHardLimit != "" || scaleVol.FilesSoftLimit != "" || scaleVol.BlockSoftLimitPc != 100
+}
+
+// needsQuota returns true if a fileset quota has to be set for the volume.
+func (scaleVol *scaleVolume) needsQuota() bool {
+	return scaleVol.VolSize != 0 || scaleVol.FilesHardLimit != "" || scaleVol.FilesSoftLimit != ""
+}
+
+// isDirectPath returns true if the volume is published from its data path
+// without a symlink in the primary fileset.
+func (scaleVol *scaleVolume) isDirectPath() bool {
+	return scaleVol.PathMode == volumeid.PathModeDirect
+}
+
+// renderFilesetName returns the fileset name generated from a fileset name
+// template. Characters not allowed in fileset names are replaced by "-".
+func renderFilesetName(tpl string, params filesetNameParams) (string, error) {
+	t, err := template.New("filesetName").Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, params)
+	if err != nil {
+		return "", err
+	}
+
+	name := filesetNameInvalidChars.ReplaceAllString(buf.String(), "-")
+	name = strings.TrimLeft(name, "-._")
+	if len(name) > filesetNameMaxLen {
+		name = name[:filesetNameMaxLen]
+	}
+	if name == "" {
+		return "", fmt.Errorf("template %q results in an empty fileset name", tpl)
+	}
+	return name, nil
+}
+
+// getFilesetNameWithSuffix returns name with a suffix derived from the PV
+// name, used when name is taken by a fileset of another volume.
+func getFilesetNameWithSuffix(name string, pvName string) string {
+	sum := sha256.Sum256([]byte(pvName))
+	suffix := hex.EncodeToString(sum[:])[:filesetNameHashLen]
+	if len(name)+len(suffix)+1 > filesetNameMaxLen {
+		name = name[:filesetNameMaxLen-len(suffix)-1]
+	}
+	return name + "-" + suffix
+}
+
+// isFilesetOwner returns true if fileset was created for volume pvName.
+// Filesets created without fileset comment are named after the volume.
+func isFilesetOwner(fileset connectors.Fileset_v2, pvName string) bool {
+	if fileset.FilesetName == pvName {
+		return true
+	}
+	comment, err := parseFilesetComment(fileset.Config.Comment)
+	if err != nil {
+		glog.V(4).Infof("Fileset %s has no owner information: %v", fileset.FilesetName, err)
+		return false
+	}
+	return comment.PVName == pvName
+}
+
+// hasPolicyRules returns true if the driver installs rules for the fileset of
+// the volume in the filesystem policy.
+func (scaleVol *scaleVolume) hasPolicyRules() bool {
+	return scaleVol.StoragePool != "" || len(scaleVol.EncryptionKeys) != 0 || len(scaleVol.PolicyTemplates) != 0
+}
+
+// hasFilesetPolicyRules returns true if the comment of fileset records rules
+// in the filesystem policy.
+func hasFilesetPolicyRules(fileset connectors.Fileset_v2) bool {
+	comment, err := parseFilesetComment(fileset.Config.Comment)
+	if err != nil {
+		return false
+	}
+	return comment.Policy == filesetCommentPolicy
+}
+
+// getCapacityBytes returns the capacity reported for a volume. Capacity of
+// directory based volumes is not enforced and is reported as unknown.
+func (scaleVol *scaleVolume) getCapacityBytes() int64 {
+	if !scaleVol.IsFilesetBased {
+		return 0
+	}
+	return int64(scaleVol.VolSize)
+}
+
+// getBlockSoftLimit returns percent of the block hard limit.
+func getBlockSoftLimit(hardLimit uint64, percent uint64) uint64 {
+	return hardLimit/100*percent + hardLimit%100*percent/100
+}
+
+// getQuotaRequestOptions returns the options of the SetFilesetQuota request for a volume.
+func (scaleVol *scaleVolume) getQuotaRequestOptions() map[string]interface{} {
+	opts := make(map[string]interface{})
+	if scaleVol.VolSize != 0 && scaleVol.BlockSoftLimitPc != 100 {
+		opts[connectors.QuotaBlockSoftLimit] = strconv.FormatUint(getBlockSoftLimit(scaleVol.VolSize, scaleVol.BlockSoftLimitPc), 10)
+	}
+	if scaleVol.FilesHardLimit != "" {
+		opts[connectors.UserSpecifiedFilesHardLimit] = scaleVol.FilesHardLimit
+	}
+	if scaleVol.FilesSoftLimit != "" {
+		opts[connectors.UserSpecifiedFilesSoftLimit] = scaleVol.FilesSoftLimit
+	}
+	if scaleVol.BlockGracePeriod != "" {
+		opts[connectors.UserSpecifiedBlockGracePeriod] = scaleVol.BlockGracePeriod
+	}
+	if scaleVol.FilesGracePeriod != "" {
+		opts[connectors.UserSpecifiedFilesGracePeriod] = scaleVol.FilesGracePeriod
+	}
+	return opts
+}
+
+// quotaMatches compares a quota limit in KiB reported by the GUI with a limit in bytes.
+func quotaMatches(limitKB int, limit uint64) bool {
+	return uint64(limitKB) == limit/1024 || uint64(limitKB) == (limit+1023)/1024
+}
+
+// getFsTopologyKey returns the topology key for a filesystem, or "" if the
+// filesystem name cannot be used in a topology key.
+func getFsTopologyKey(fsName string) string {
+	if !topologyFsNameRegex.MatchString(fsName) {
+		glog.Warningf("Filesystem name %s can not be used as topology key", fsName)
+		return ""
+	}
+	return topologyKeyFsPfx + fsName
+}
+
+// parseMountOptions merges comma separated lists of mount options. It returns
+// the options sorted and without duplicates, so that the result can be compared.
+func parseMountOptions(optionLists ...string) (string, error) {
+	values := make(map[string]string)
+	for _, list := range optionLists {
+		for _, opt := range strings.Split(list, ",") {
+			opt = strings.TrimSpace(opt)
+			if opt == "" {
+				continue
+			}
+			if !mountOptionRegex.MatchString(opt) {
+				return "", fmt.Errorf("invalid mount option %q", opt)
+			}
+			kv := strings.SplitN(opt, "=", 2)
+			if prev, ok := values[kv[0]]; ok && prev != opt {
+				return "", fmt.Errorf("mount options %q and %q conflict", prev, opt)
+			}
+			values[kv[0]] = opt
+		}
+	}
+
+	var opts []string
+	for key, opt := range values {
+		conflict, hasConflict := conflictingMountOptions[key]
+		if !hasConflict && !strings.HasPrefix(key, "no") {
+			conflict, hasConflict = "no"+key, true
+		}
+		if other, ok := values[conflict]; hasConflict && ok {
+			return "", fmt.Errorf("mount options %q and %q conflict", opt, other)
+		}
+		opts = append(opts, opt)
+	}
+	sort.Strings(opts)
+	return strings.Join(opts, ","), nil
+}
+
 func executeCmd(command string, args []string) ([]byte, error) {
 	glog.V(5).Infof("gpfs_util executeCmd")
 
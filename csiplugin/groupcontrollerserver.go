@@ -0,0 +1,404 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/connectors"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/volumeid"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Snapshots are taken per inode space. Dependent fileset based volumes share
+// the inode space of their parent fileset, a group snapshot of them is one
+// snapshot of the independent parent fileset. Group snapshots are named after
+// the hash of the group snapshot name and their creation time, e.g.
+// csi-grp-3f2a9c0d41be-20191104T101523Z.
+//
+// The group snapshot ID references the parent fileset, the snapshot IDs of the
+// members reference the fileset of their volume.
+const (
+	groupSnapshotPrefix     = "csi-grp-"
+	groupSnapshotHashLen    = 12
+	groupSnapshotTimeFormat = "20060102T150405Z"
+)
+
+type ScaleGroupControllerServer struct {
+	Driver *ScaleDriver
+}
+
+// groupSnapshotNamePrefix returns the prefix of the names of the snapshots of
+// the group snapshot name.
+func groupSnapshotNamePrefix(name string) string {
+	return hashedSnapshotNamePrefix(groupSnapshotPrefix, name)
+}
+
+// parseGroupSnapshotName returns the creation time of a group snapshot, and
+// false for snapshots not created for a group snapshot.
+func parseGroupSnapshotName(name string) (time.Time, bool) {
+	return parseHashedSnapshotName(groupSnapshotPrefix, name)
+}
+
+// hashedSnapshotNamePrefix returns prefix followed by the hash of the name of
+// a CSI request, the snapshots created for the request start with it.
+func hashedSnapshotNamePrefix(prefix string, name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return prefix + hex.EncodeToString(sum[:])[:groupSnapshotHashLen] + "-"
+}
+
+// parseHashedSnapshotName returns the creation time of a snapshot named by
+// hashedSnapshotNamePrefix, and false for other snapshots.
+func parseHashedSnapshotName(prefix string, name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return time.Time{}, false
+	}
+	fields := strings.SplitN(strings.TrimPrefix(name, prefix), "-", 2)
+	if len(fields) != 2 || len(fields[0]) != groupSnapshotHashLen {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(groupSnapshotTimeFormat, fields[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// getFilesetKey returns the fields of the volume ID of volumeIdMembers
+// identifying fileset instead of the fileset of the volume.
+func getFilesetKey(volumeIdMembers volumeid.VolumeID, fileset connectors.Fileset_v2) volumeid.VolumeID {
+	return volumeid.VolumeID{
+		Version:     volumeid.Version2,
+		ClusterId:   volumeIdMembers.ClusterId,
+		FsUUID:      volumeIdMembers.FsUUID,
+		VolType:     volumeid.TypeFileset,
+		FsetId:      strconv.Itoa(fileset.Config.Id),
+		PrimaryName: volumeIdMembers.PrimaryName,
+	}
+}
+
+// GetInodeSpaceOwner returns the independent fileset owning the inode space
+// of fileset filesetName, the fileset itself if it is independent.
+func (cs *ScaleControllerServer) GetInodeSpaceOwner(conn connectors.SpectrumScaleConnector, filesystemName string, filesetName string) (connectors.Fileset_v2, error) {
+	fset, err := conn.ListFileset(filesystemName, filesetName)
+	if err != nil {
+		return connectors.Fileset_v2{}, status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+	if fset.Config.IsInodeSpaceOwner {
+		return fset, nil
+	}
+
+	filesets, err := conn.ListFilesets(filesystemName)
+	if err != nil {
+		return connectors.Fileset_v2{}, status.Error(codes.Internal, fmt.Sprintf("Unable to list filesets of FS [%v]. Error [%v]", filesystemName, err))
+	}
+	for _, owner := range filesets {
+		if owner.Config.IsInodeSpaceOwner && owner.Config.InodeSpace == fset.Config.InodeSpace {
+			return owner, nil
+		}
+	}
+	return connectors.Fileset_v2{}, status.Error(codes.Internal, fmt.Sprintf("Unable to find the fileset owning inode space [%v] of Fset [%v] in FS [%v]", fset.Config.InodeSpace, filesetName, filesystemName))
+}
+
+// GroupControllerGetCapabilities implements the default GRPC callout.
+func (gcs *ScaleGroupControllerServer) GroupControllerGetCapabilities(ctx context.Context, req *csi.GroupControllerGetCapabilitiesRequest) (*csi.GroupControllerGetCapabilitiesResponse, error) {
+	glog.V(4).Infof("GroupControllerGetCapabilities called with req: %#v", req)
+	return &csi.GroupControllerGetCapabilitiesResponse{
+		Capabilities: gcs.Driver.gcscap,
+	}, nil
+}
+
+// CreateVolumeGroupSnapshot snapshots the independent parent fileset of
+// dependent fileset based volumes sharing its inode space.
+func (gcs *ScaleGroupControllerServer) CreateVolumeGroupSnapshot(ctx context.Context, req *csi.CreateVolumeGroupSnapshotRequest) (*csi.CreateVolumeGroupSnapshotResponse, error) { //nolint:gocyclo,funlen
+	glog.V(3).Infof("create volume group snapshot req: %v", req)
+
+	if err := gcs.Driver.ValidateGroupControllerServiceRequest(csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT); err != nil {
+		glog.V(3).Infof("invalid create volume group snapshot req: %v", req)
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("CreateVolumeGroupSnapshot ValidateGroupControllerServiceRequest failed: %v", err))
+	}
+
+	groupName := req.GetName()
+	if groupName == "" {
+		return nil, status.Error(codes.InvalidArgument, "Group snapshot name is a required field")
+	}
+	volumeIDs := req.GetSourceVolumeIds()
+	if len(volumeIDs) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Source volume IDs is a required field")
+	}
+
+	members := make([]volumeid.VolumeID, len(volumeIDs))
+	for i, volumeID := range volumeIDs {
+		volumeIdMembers, err := gcs.Driver.cs.GetVolIdMembers(volumeID)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("Invalid Volume Id [%v]", volumeID))
+		}
+		volumeIdMembers, err = gcs.Driver.cs.ResolveVolumeId(volumeID, volumeIdMembers)
+		if err != nil {
+			return nil, err
+		}
+		if !volumeIdMembers.IsFilesetBased() {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume [%v] is not fileset based, only dependent fileset based volumes can be snapshot as a group", volumeID))
+		}
+		if i > 0 && (volumeIdMembers.ClusterId != members[0].ClusterId ||
+			volumeIdMembers.FsUUID != members[0].FsUUID ||
+			volumeIdMembers.PrimaryName != members[0].PrimaryName) {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume [%v] is not in the cluster and filesystem of volume [%v]", volumeID, volumeIDs[0]))
+		}
+		members[i] = volumeIdMembers
+	}
+
+	conn, err := gcs.Driver.cs.GetConnFromClusterID(members[0].ClusterId)
+	if err != nil {
+		return nil, err
+	}
+
+	/* All members must be dependent filesets linked in the same independent fileset */
+	var filesystemName string
+	memberFsets := make([]connectors.Fileset_v2, len(members))
+	for i, volumeIdMembers := range members {
+		fsName, filesetName, err := gcs.Driver.cs.GetFilesetOfVolume(conn, volumeIdMembers)
+		if err != nil {
+			return nil, err
+		}
+		filesystemName = fsName
+		fset, err := conn.ListFileset(fsName, filesetName)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", filesetName, fsName, err))
+		}
+		if fset.Config.IsInodeSpaceOwner {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume [%v] is an independent fileset, only dependent fileset based volumes sharing a parent fileset can be snapshot as a group", volumeIDs[i]))
+		}
+		if i > 0 && fset.Config.InodeSpace != memberFsets[0].Config.InodeSpace {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volumes [%v] and [%v] are not in the inode space of the same parent fileset", volumeIDs[0], volumeIDs[i]))
+		}
+		memberFsets[i] = fset
+	}
+
+	parent, err := gcs.Driver.cs.GetInodeSpaceOwner(conn, filesystemName, memberFsets[0].FilesetName)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Config.Id == 0 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volumes [%v] are in the inode space of the root fileset of FS [%v], snapshots of the filesystem are not supported", strings.Join(volumeIDs, ", "), filesystemName))
+	}
+	for i, fset := range memberFsets {
+		if fset.Config.ParentId != parent.Config.Id {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume [%v] is not linked in parent fileset [%v] of FS [%v]", volumeIDs[i], parent.FilesetName, filesystemName))
+		}
+	}
+
+	snapshots, err := conn.ListFilesetSnapshots(filesystemName, parent.FilesetName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to list snapshots of Fset [%v] in FS [%v]. Error [%v]", parent.FilesetName, filesystemName, err))
+	}
+
+	/* A retried request finds the snapshot created for the group snapshot name */
+	snapshotName := ""
+	namePrefix := groupSnapshotNamePrefix(groupName)
+	for _, snapshot := range snapshots {
+		if strings.HasPrefix(snapshot.SnapshotName, namePrefix) {
+			snapshotName = snapshot.SnapshotName
+			break
+		}
+	}
+	if snapshotName == "" {
+		snapshotName = namePrefix + time.Now().UTC().Format(groupSnapshotTimeFormat)
+		err = conn.CreateFilesetSnapshot(filesystemName, parent.FilesetName, snapshotName)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to create snapshot [%v] of Fset [%v] in FS [%v]. Error [%v]", snapshotName, parent.FilesetName, filesystemName, err))
+		}
+		glog.Infof("Created snapshot %s of fileset %s in FS %s for group snapshot %s", snapshotName, parent.FilesetName, filesystemName, groupName)
+	}
+
+	created, _ := parseGroupSnapshotName(snapshotName)
+	creationTime, err := ptypes.TimestampProto(created)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Invalid creation time of snapshot [%v]. Error [%v]", snapshotName, err))
+	}
+
+	groupSnapshotId := encodeSnapshotId(snapshotName, getFilesetKey(members[0], parent))
+	groupSnapshot := &csi.VolumeGroupSnapshot{
+		GroupSnapshotId: groupSnapshotId,
+		CreationTime:    creationTime,
+		ReadyToUse:      true,
+	}
+	for i, volumeIdMembers := range members {
+		groupSnapshot.Snapshots = append(groupSnapshot.Snapshots, &csi.Snapshot{
+			SnapshotId:      encodeSnapshotId(snapshotName, volumeIdMembers),
+			SourceVolumeId:  volumeIDs[i],
+			CreationTime:    creationTime,
+			ReadyToUse:      true,
+			GroupSnapshotId: groupSnapshotId,
+		})
+	}
+
+	return &csi.CreateVolumeGroupSnapshotResponse{GroupSnapshot: groupSnapshot}, nil
+}
+
+// DeleteVolumeGroupSnapshot deletes the snapshot of the parent fileset of a
+// group snapshot.
+func (gcs *ScaleGroupControllerServer) DeleteVolumeGroupSnapshot(ctx context.Context, req *csi.DeleteVolumeGroupSnapshotRequest) (*csi.DeleteVolumeGroupSnapshotResponse, error) {
+	glog.V(3).Infof("delete volume group snapshot req: %v", req)
+
+	if err := gcs.Driver.ValidateGroupControllerServiceRequest(csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT); err != nil {
+		glog.V(3).Infof("invalid delete volume group snapshot req: %v", req)
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("DeleteVolumeGroupSnapshot ValidateGroupControllerServiceRequest failed: %v", err))
+	}
+
+	snapshotName, parentKey, err := gcs.decodeGroupSnapshotIds(req.GetGroupSnapshotId(), req.GetSnapshotIds())
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := gcs.Driver.cs.GetConnFromClusterID(parentKey.ClusterId)
+	if err != nil {
+		return nil, err
+	}
+
+	filesystemName, parentName, err := gcs.Driver.cs.GetFilesetOfVolume(conn, parentKey)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			glog.Infof("Parent fileset of group snapshot [%v] not found, the group snapshot is deleted", req.GetGroupSnapshotId())
+			return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
+		}
+		return nil, err
+	}
+
+	err = conn.DeleteFilesetSnapshot(filesystemName, parentName, snapshotName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to delete snapshot [%v] of Fset [%v] in FS [%v]. Error [%v]", snapshotName, parentName, filesystemName, err))
+	}
+	glog.Infof("Deleted snapshot %s of fileset %s in FS %s", snapshotName, parentName, filesystemName)
+
+	return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
+}
+
+// GetVolumeGroupSnapshot returns a group snapshot with the snapshots of its
+// members. Members only report a volume ID of their fileset in direct path
+// mode as source volume ID.
+func (gcs *ScaleGroupControllerServer) GetVolumeGroupSnapshot(ctx context.Context, req *csi.GetVolumeGroupSnapshotRequest) (*csi.GetVolumeGroupSnapshotResponse, error) { //nolint:funlen
+	glog.V(3).Infof("get volume group snapshot req: %v", req)
+
+	if err := gcs.Driver.ValidateGroupControllerServiceRequest(csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT); err != nil {
+		glog.V(3).Infof("invalid get volume group snapshot req: %v", req)
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("GetVolumeGroupSnapshot ValidateGroupControllerServiceRequest failed: %v", err))
+	}
+
+	groupSnapshotId := req.GetGroupSnapshotId()
+	snapshotName, parentKey, err := gcs.decodeGroupSnapshotIds(groupSnapshotId, req.GetSnapshotIds())
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := gcs.Driver.cs.GetConnFromClusterID(parentKey.ClusterId)
+	if err != nil {
+		return nil, err
+	}
+
+	filesystemName, parentName, err := gcs.Driver.cs.GetFilesetOfVolume(conn, parentKey)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("Group snapshot [%v] not found, its parent fileset does not exist", groupSnapshotId))
+		}
+		return nil, err
+	}
+
+	snapshots, err := conn.ListFilesetSnapshots(filesystemName, parentName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to list snapshots of Fset [%v] in FS [%v]. Error [%v]", parentName, filesystemName, err))
+	}
+	found := false
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotName == snapshotName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("Snapshot [%v] of group snapshot [%v] not found in Fset [%v] of FS [%v]", snapshotName, groupSnapshotId, parentName, filesystemName))
+	}
+
+	created, _ := parseGroupSnapshotName(snapshotName)
+	creationTime, err := ptypes.TimestampProto(created)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Invalid creation time of snapshot [%v]. Error [%v]", snapshotName, err))
+	}
+
+	groupSnapshot := &csi.VolumeGroupSnapshot{
+		GroupSnapshotId: groupSnapshotId,
+		CreationTime:    creationTime,
+		ReadyToUse:      true,
+	}
+	for _, snapshotId := range req.GetSnapshotIds() {
+		_, memberKey, _ := decodeSnapshotId(snapshotId)
+		memberFsName, memberFsetName, err := gcs.Driver.cs.GetFilesetOfVolume(conn, memberKey)
+		if err != nil {
+			return nil, err
+		}
+		volumeID, err := gcs.Driver.cs.GetFilesetVolumeId(conn, memberKey, memberFsName, memberFsetName)
+		if err != nil {
+			return nil, err
+		}
+		groupSnapshot.Snapshots = append(groupSnapshot.Snapshots, &csi.Snapshot{
+			SnapshotId:      snapshotId,
+			SourceVolumeId:  volumeID,
+			CreationTime:    creationTime,
+			ReadyToUse:      true,
+			GroupSnapshotId: groupSnapshotId,
+		})
+	}
+
+	return &csi.GetVolumeGroupSnapshotResponse{GroupSnapshot: groupSnapshot}, nil
+}
+
+// decodeGroupSnapshotIds returns the snapshot name and the fields identifying
+// the parent fileset of a group snapshot ID, after checking that the snapshot
+// IDs of its members reference the same snapshot.
+func (gcs *ScaleGroupControllerServer) decodeGroupSnapshotIds(groupSnapshotId string, snapshotIds []string) (string, volumeid.VolumeID, error) {
+	if groupSnapshotId == "" {
+		return "", volumeid.VolumeID{}, status.Error(codes.InvalidArgument, "Group snapshot ID is a required field")
+	}
+	snapshotName, parentKey, err := decodeSnapshotId(groupSnapshotId)
+	if err != nil {
+		return "", volumeid.VolumeID{}, status.Error(codes.NotFound, fmt.Sprintf("Invalid group snapshot ID [%v]. Error [%v]", groupSnapshotId, err))
+	}
+	if _, ok := parseGroupSnapshotName(snapshotName); !ok {
+		return "", volumeid.VolumeID{}, status.Error(codes.NotFound, fmt.Sprintf("Group snapshot ID [%v] does not reference a group snapshot", groupSnapshotId))
+	}
+
+	for _, snapshotId := range snapshotIds {
+		name, memberKey, err := decodeSnapshotId(snapshotId)
+		if err != nil || name != snapshotName ||
+			memberKey.ClusterId != parentKey.ClusterId ||
+			memberKey.FsUUID != parentKey.FsUUID ||
+			memberKey.PrimaryName != parentKey.PrimaryName {
+			return "", volumeid.VolumeID{}, status.Error(codes.InvalidArgument, fmt.Sprintf("Snapshot ID [%v] is not a member of group snapshot [%v]", snapshotId, groupSnapshotId))
+		}
+	}
+	return snapshotName, parentKey, nil
+}
@@ -0,0 +1,168 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/connectors"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	eventReasonInodeLimitExpanded = "InodeLimitExpanded"
+	eventReasonInodeLimitReached  = "InodeLimitReached"
+)
+
+// InodeExpansion configures the growth of the inode limit of independent
+// filesets created by the driver. Once the used inodes of a fileset reach
+// Threshold percent of its inode limit, the limit is raised by Step inodes,
+// up to Max inodes.
+type InodeExpansion struct {
+	Interval  time.Duration
+	Threshold int
+	Step      uint64
+	Max       uint64
+}
+
+// Validate checks the inode expansion settings, an Interval of 0 disables
+// the expansion.
+func (e InodeExpansion) Validate() error {
+	if e.Interval == 0 {
+		return nil
+	}
+	if e.Threshold < 1 || e.Threshold > 99 {
+		return fmt.Errorf("inode expansion threshold %d must be between 1 and 99 percent", e.Threshold)
+	}
+	if e.Step == 0 {
+		return fmt.Errorf("inode expansion step must be greater than 0")
+	}
+	if e.Max == 0 {
+		return fmt.Errorf("maximum inode limit must be greater than 0")
+	}
+	return nil
+}
+
+// getInodeLimit returns the inode limit a fileset is grown to, or 0 if the
+// limit is not to be changed. The used inodes of an independent fileset are
+// those of its inode space.
+func (e InodeExpansion) getInodeLimit(fileset connectors.Fileset_v2) uint64 {
+	limit := uint64(fileset.Config.MaxNumInodes)
+	used := uint64(fileset.Usage.InodeSpaceUsedInodes)
+	if used == 0 {
+		used = uint64(fileset.Usage.UsedInodes)
+	}
+	if limit == 0 || used*100 < limit*uint64(e.Threshold) {
+		return 0
+	}
+
+	newLimit := limit + e.Step
+	if newLimit > e.Max {
+		newLimit = e.Max
+	}
+	if newLimit <= limit {
+		return 0
+	}
+	return newLimit
+}
+
+// RunInodeExpansion grows the inode limits of the filesets of all clusters
+// every interval until stop is closed.
+func (cs *ScaleControllerServer) RunInodeExpansion(expansion InodeExpansion, stop <-chan struct{}) {
+	glog.Infof("Starting inode expansion with interval %v, threshold %d%%, step %d and maximum %d inodes", expansion.Interval, expansion.Threshold, expansion.Step, expansion.Max)
+	ticker := time.NewTicker(expansion.Interval)
+	defer ticker.Stop()
+
+	for {
+		cs.ExpandInodeLimits(expansion)
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ExpandInodeLimits raises the inode limits of the independent filesets
+// created by the driver whose used inodes reached the threshold. It runs in
+// the leader among the driver instances only, see runAsLeader.
+func (cs *ScaleControllerServer) ExpandInodeLimits(expansion InodeExpansion) {
+	for clusterId, conn := range cs.Driver.connmap {
+		filesystems, err := conn.ListFilesystems()
+		if err != nil {
+			glog.Errorf("Unable to list filesystems of cluster %s for inode expansion: %v", clusterId, err)
+			continue
+		}
+
+		for _, fsName := range filesystems {
+			filesets, err := conn.ListFilesets(fsName)
+			if err != nil {
+				/* Filesets of remotely mounted filesystems are listed by their owning cluster */
+				glog.V(4).Infof("Unable to list filesets of FS %s in cluster %s: %v", fsName, clusterId, err)
+				continue
+			}
+
+			for _, fileset := range filesets {
+				if !fileset.Config.IsInodeSpaceOwner {
+					continue
+				}
+				comment, err := parseFilesetComment(fileset.Config.Comment)
+				if err != nil || comment.Driver != cs.Driver.name {
+					continue
+				}
+				cs.expandInodeLimit(conn, fsName, fileset, comment.PVName, expansion)
+			}
+		}
+	}
+}
+
+// expandInodeLimit raises the inode limit of fileset if its used inodes
+// reached the threshold. The limit is only raised if it did not change since
+// the filesets were listed, e.g. by an instance which was the leader before.
+func (cs *ScaleControllerServer) expandInodeLimit(conn connectors.SpectrumScaleConnector, fsName string, fileset connectors.Fileset_v2, pvName string, expansion InodeExpansion) {
+	limit := fileset.Config.MaxNumInodes
+	newLimit := expansion.getInodeLimit(fileset)
+	if newLimit == 0 {
+		return
+	}
+
+	current, err := conn.ListFileset(fsName, fileset.FilesetName)
+	if err != nil {
+		glog.Errorf("Unable to list fileset %s in FS %s for inode expansion: %v", fileset.FilesetName, fsName, err)
+		return
+	}
+	if current.Config.MaxNumInodes != limit {
+		glog.V(4).Infof("Inode limit of fileset %s in FS %s changed from %d to %d, skipping inode expansion", fileset.FilesetName, fsName, limit, current.Config.MaxNumInodes)
+		return
+	}
+
+	err = conn.SetFilesetInodeLimit(fsName, fileset.FilesetName, strconv.FormatUint(newLimit, 10))
+	if err != nil {
+		glog.Errorf("Unable to raise inode limit of fileset %s in FS %s to %d: %v", fileset.FilesetName, fsName, newLimit, err)
+		return
+	}
+
+	message := fmt.Sprintf("Inode limit of fileset %s in filesystem %s raised from %d to %d", fileset.FilesetName, fsName, limit, newLimit)
+	cs.Driver.events.Event(pvName, corev1.EventTypeNormal, eventReasonInodeLimitExpanded, message)
+	if newLimit == expansion.Max {
+		message = fmt.Sprintf("Inode limit of fileset %s in filesystem %s reached the maximum of %d inodes", fileset.FilesetName, fsName, expansion.Max)
+		cs.Driver.events.Event(pvName, corev1.EventTypeWarning, eventReasonInodeLimitReached, message)
+	}
+}
@@ -0,0 +1,83 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Background tasks of the controller service, like the snapshot scheduler,
+// run in one driver instance only. The instance holding the Lease named after
+// the driver runs them, the other instances wait to take over.
+const (
+	leaderLeaseSuffix        = "-controller-tasks"
+	leaderLeaseDuration      = 15 * time.Second
+	leaderLeaseRenewDeadline = 10 * time.Second
+	leaderLeaseRetryPeriod   = 2 * time.Second
+)
+
+// runAsLeader runs tasks while this driver instance is the leader among the
+// instances of all nodes. tasks must return when stop is closed. Without the
+// Kubernetes API, the controller state is local to the node and tasks are run
+// directly.
+func (driver *ScaleDriver) runAsLeader(tasks func(stop <-chan struct{})) {
+	if driver.kubeClient == nil {
+		glog.Warningf("Running background tasks of the controller service without leader election, the controller state is not kept in kubernetes")
+		tasks(make(chan struct{}))
+		return
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      driver.name + leaderLeaseSuffix,
+			Namespace: driver.kubeNamespace,
+		},
+		Client: driver.kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: driver.nodeID,
+		},
+	}
+
+	for {
+		leaderelection.RunOrDie(context.Background(), leaderelection.LeaderElectionConfig{
+			Lock:          lock,
+			LeaseDuration: leaderLeaseDuration,
+			RenewDeadline: leaderLeaseRenewDeadline,
+			RetryPeriod:   leaderLeaseRetryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					glog.Infof("Driver instance %s is the leader, starting background tasks", driver.nodeID)
+					tasks(ctx.Done())
+				},
+				OnStoppedLeading: func() {
+					glog.Infof("Driver instance %s is no longer the leader, background tasks stopped", driver.nodeID)
+				},
+				OnNewLeader: func(identity string) {
+					if identity != driver.nodeID {
+						glog.Infof("Background tasks of the controller service run in driver instance %s", identity)
+					}
+				},
+			},
+		})
+	}
+}
@@ -0,0 +1,432 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/connectors"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/volumeid"
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// migrationTarget is the location a volume is migrated to. LocalFs is the
+// name of the target filesystem in the primary cluster, Fs its name in the
+// cluster owning it.
+type migrationTarget struct {
+	ClusterId string
+	Conn      connectors.SpectrumScaleConnector
+	LocalFs   string
+	Fs        string
+	Fileset   string
+}
+
+// MigrateVolume moves the fileset based volume volumeID to a new fileset in
+// filesystem targetFs of cluster targetClusterId, and returns the ID of the
+// migrated volume. targetFs is the name of the filesystem in the primary
+// cluster, the cluster of the volume is used if targetClusterId is empty.
+//
+// The volume must not be published. The data is copied to the new fileset,
+// the symlink of the volume in the primary fileset is pointed to the copy and
+// the old fileset is deleted. The path of the volume stays the same, the
+// cluster, filesystem and fileset in its ID change. The old ID is resolved to
+// the new ID through the operation journal, which is kept in kubernetes so
+// that it is shared by the driver instances of all nodes. Each completed step
+// is recorded in the journal, so a failed migration is resumed by migrating
+// the volume again. The volume can not be published until the migration is
+// completed.
+func (cs *ScaleControllerServer) MigrateVolume(volumeID string, targetClusterId string, targetFs string) (string, error) { //nolint:gocyclo,funlen
+	glog.Infof("Migrating volume [%v] to FS [%v] in cluster [%v]", volumeID, targetFs, targetClusterId)
+
+	volumeIdMembers, err := cs.GetVolIdMembers(volumeID)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !volumeIdMembers.IsFilesetBased() {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("Volume [%v] is not fileset based, only fileset based volumes can be migrated", volumeID))
+	}
+	if volumeIdMembers.IsDirectPath() {
+		return "", status.Error(codes.InvalidArgument, fmt.Sprintf("Volume [%v] is in direct path mode, only volumes with a symlink in the primary fileset can be migrated", volumeID))
+	}
+	if volumeIdMembers.NfsExport {
+		return "", status.Error(codes.FailedPrecondition, fmt.Sprintf("Volume [%v] is exported through CES NFS, delete the export before migrating the volume", volumeID))
+	}
+	if cs.Driver.kubeClient == nil {
+		return "", status.Error(codes.FailedPrecondition, "Volumes can only be migrated with the controller state kept in kubernetes, the driver instances of other nodes would not resolve the old volume ID")
+	}
+	if targetClusterId == "" {
+		targetClusterId = volumeIdMembers.ClusterId
+	}
+
+	entry, found, err := cs.Driver.journal.Get(operationMigrate, volumeID)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to read operation journal. Error [%v]", err))
+	}
+	if found {
+		if entry.reached(migrateStepDone) && (entry.TargetCluster != targetClusterId || entry.TargetFs != targetFs) {
+			return "", status.Error(codes.FailedPrecondition, fmt.Sprintf("Volume [%v] was migrated to FS [%v] in cluster [%v], migrate volume ID [%v] instead", volumeID, entry.TargetFs, entry.TargetCluster, entry.NewVolumeID))
+		}
+		if entry.TargetCluster != targetClusterId || entry.TargetFs != targetFs {
+			return "", status.Error(codes.FailedPrecondition, fmt.Sprintf("Migration of volume [%v] to FS [%v] in cluster [%v] is in progress, it must be completed first", volumeID, entry.TargetFs, entry.TargetCluster))
+		}
+		if entry.reached(migrateStepDone) {
+			glog.Infof("Volume [%v] was already migrated, new volume ID [%v]", volumeID, entry.NewVolumeID)
+			return entry.NewVolumeID, nil
+		}
+		glog.Infof("Resuming migration of volume [%v] after step [%v]", volumeID, entry.Step)
+	} else {
+		/* Recorded first, so that the volume is not published while it is checked */
+		entry = operationEntry{Operation: operationMigrate, VolumeID: volumeID, TargetCluster: targetClusterId, TargetFs: targetFs, Step: migrateStepStarted}
+		err = cs.Driver.journal.Record(entry)
+		if err != nil {
+			return "", status.Error(codes.Internal, fmt.Sprintf("Unable to record migration of volume [%v] in operation journal. Error [%v]", volumeID, err))
+		}
+	}
+
+	/* Migrations failing before the target fileset is created are dropped, the volume stays usable */
+	fail := func(err error) (string, error) {
+		if entry.Step == migrateStepStarted {
+			if removeErr := cs.Driver.journal.Remove(operationMigrate, volumeID); removeErr != nil {
+				glog.Errorf("Unable to remove migration of volume [%v] from operation journal: %v", volumeID, removeErr)
+			}
+			return "", err
+		}
+		entry.Error = err.Error()
+		if recordErr := cs.Driver.journal.Record(entry); recordErr != nil {
+			glog.Errorf("Unable to record migration of volume [%v] in operation journal: %v", volumeID, recordErr)
+		}
+		return "", err
+	}
+
+	if !entry.reached(migrateStepCopied) {
+		err = cs.checkVolumeUnpublished(volumeID)
+		if err != nil {
+			return fail(err)
+		}
+	}
+	advance := func(step string) error {
+		entry.Step = step
+		entry.Error = ""
+		err := cs.Driver.journal.Record(entry)
+		if err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("Unable to record migration of volume [%v] in operation journal. Error [%v]", volumeID, err))
+		}
+		glog.Infof("Migration of volume [%v]: step [%v] completed", volumeID, step)
+		return nil
+	}
+
+	primary, primaryConn, err := cs.Driver.GetPrimary(volumeIdMembers.PrimaryName)
+	if err != nil {
+		return fail(status.Error(codes.Internal, fmt.Sprintf("Unable to get primary of volume [%v]. Error [%v]", volumeID, err)))
+	}
+	sLinkRelPath := strings.Trim(strings.Replace(volumeIdMembers.SymLnkPath, primary.PrimaryFSMount, "", 1), "!/")
+	pvName := filepath.Base(sLinkRelPath)
+
+	conn, err := cs.GetConnFromClusterID(volumeIdMembers.ClusterId)
+	if err != nil {
+		return fail(err)
+	}
+
+	target := migrationTarget{ClusterId: targetClusterId, LocalFs: targetFs}
+	target.Conn, err = cs.GetConnFromClusterID(targetClusterId)
+	if err != nil {
+		return fail(err)
+	}
+	mountInfo, err := primaryConn.GetFilesystemMountDetails(targetFs)
+	if err != nil {
+		return fail(status.Error(codes.Internal, fmt.Sprintf("Unable to get Mount Details for FS [%v] in Primary cluster. Error [%v]", targetFs, err)))
+	}
+	splitDevName := strings.Split(mountInfo.RemoteDeviceName, ":")
+	target.Fs = splitDevName[len(splitDevName)-1]
+
+	/* The old fileset is deleted once the symlink points to the copy */
+	filesystemName, filesetName := "", ""
+	if !entry.reached(migrateStepLinked) {
+		filesystemName, filesetName, err = cs.GetFilesetOfVolume(conn, volumeIdMembers)
+		if err != nil {
+			return fail(err)
+		}
+		if volumeIdMembers.ClusterId == targetClusterId && filesystemName == target.Fs {
+			return fail(status.Error(codes.InvalidArgument, fmt.Sprintf("Volume [%v] already is in FS [%v] of cluster [%v]", volumeID, target.Fs, targetClusterId)))
+		}
+	}
+
+	if !entry.reached(migrateStepCreated) {
+		err = cs.createMigrationFileset(conn, filesystemName, filesetName, pvName, &target)
+		if err != nil {
+			return fail(err)
+		}
+		entry.TargetFileset = target.Fileset
+		if err = advance(migrateStepCreated); err != nil {
+			return fail(err)
+		}
+	}
+	target.Fileset = entry.TargetFileset
+
+	targetDataPath, err := cs.getFilesetDataPath(target.Conn, target.Fs, target.Fileset, pvName)
+	if err != nil {
+		return fail(err)
+	}
+
+	if !entry.reached(migrateStepCopied) {
+		sourceDataPath, err := cs.getFilesetDataPath(conn, filesystemName, filesetName, pvName)
+		if err != nil {
+			return fail(err)
+		}
+		/* Both filesystems are mounted in the primary cluster, the copy is done there */
+		sourceLocalFs, err := primaryConn.GetFilesystemName(volumeIdMembers.FsUUID)
+		if err != nil {
+			return fail(status.Error(codes.Internal, fmt.Sprintf("Unable to get filesystem Name for Id [%v]. Error [%v]", volumeIdMembers.FsUUID, err)))
+		}
+		err = primaryConn.CopyDirectory(sourceLocalFs, sourceDataPath, target.LocalFs, targetDataPath)
+		if err != nil {
+			return fail(status.Error(codes.Internal, fmt.Sprintf("Unable to copy [%v] in FS [%v] to [%v] in FS [%v]. Error [%v]", sourceDataPath, sourceLocalFs, targetDataPath, target.LocalFs, err)))
+		}
+		if err = advance(migrateStepCopied); err != nil {
+			return fail(err)
+		}
+	}
+
+	if !entry.reached(migrateStepLinked) {
+		/* Creating an existing symlink succeeds, so the old symlink is deleted first */
+		err = primaryConn.DeleteSymLnk(primary.GetPrimaryFs(), sLinkRelPath)
+		if err != nil {
+			return fail(status.Error(codes.Internal, fmt.Sprintf("Unable to delete symlnk [%v:%v] Error [%v]", primary.GetPrimaryFs(), sLinkRelPath, err)))
+		}
+		err = primaryConn.CreateSymLink(primary.GetPrimaryFs(), target.LocalFs, targetDataPath, sLinkRelPath)
+		if err != nil {
+			return fail(status.Error(codes.Internal, fmt.Sprintf("Failed to create symlink [%v] in FS [%v], for target [%v] in FS [%v]. Error [%v]", sLinkRelPath, primary.GetPrimaryFs(), targetDataPath, target.LocalFs, err)))
+		}
+
+		newVolumeID, err := cs.getMigratedVolumeId(volumeIdMembers, primaryConn, target)
+		if err != nil {
+			return fail(err)
+		}
+		entry.NewVolumeID = newVolumeID
+		if err = advance(migrateStepLinked); err != nil {
+			return fail(err)
+		}
+	}
+
+	err = cs.retireFileset(conn, volumeIdMembers, pvName)
+	if err != nil {
+		return fail(err)
+	}
+	if err = advance(migrateStepDone); err != nil {
+		return fail(err)
+	}
+
+	glog.Infof("Volume [%v] migrated to fileset [%v] in FS [%v] of cluster [%v], new volume ID [%v]", volumeID, target.Fileset, target.Fs, targetClusterId, entry.NewVolumeID)
+	return entry.NewVolumeID, nil
+}
+
+// checkVolumeUnpublished returns an error if a volume is published on a node
+// under its ID or an ID it had before an earlier migration.
+func (cs *ScaleControllerServer) checkVolumeUnpublished(volumeID string) error {
+	volumeIDs, err := cs.Driver.journal.GetVolumeIds(volumeID)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to read operation journal. Error [%v]", err))
+	}
+	for _, id := range volumeIDs {
+		nodes, err := cs.Driver.publishTracker.GetVolumeNodes(id)
+		if err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("Unable to get nodes volume [%v] is published on. Error [%v]", id, err))
+		}
+		if len(nodes) > 0 {
+			return status.Error(codes.FailedPrecondition, fmt.Sprintf("Volume [%v] is published on nodes %v, stop the pods using it before migrating the volume", id, nodes))
+		}
+	}
+	return nil
+}
+
+// createMigrationFileset creates the fileset a volume is migrated to with the
+// same name, comment, inode limit and quota as the fileset of the volume, and
+// the data directory of the volume in it. Dependent filesets are created in
+// the root fileset of the target filesystem.
+func (cs *ScaleControllerServer) createMigrationFileset(conn connectors.SpectrumScaleConnector, filesystemName string, filesetName string, pvName string, target *migrationTarget) error { //nolint:funlen
+	fset, err := conn.ListFileset(filesystemName, filesetName)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+	if !isFilesetOwner(fset, pvName) {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("Fileset [%v] in FS [%v] was not created for volume [%v]", filesetName, filesystemName, pvName))
+	}
+	if fset.AFM.AFMMode != "" {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("Fileset [%v] in FS [%v] is an AFM cache, its data is in the AFM home", filesetName, filesystemName))
+	}
+	if isImmutable(iamModes[strings.ToLower(fset.Config.IamMode)]) {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("Fileset [%v] in FS [%v] has IAM mode [%v] and can not be retired", filesetName, filesystemName, fset.Config.IamMode))
+	}
+
+	/* Placement, encryption and template rules are not installed for the copy, which would still claim them in its comment */
+	policy, err := conn.GetFilesystemPolicy(filesystemName)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to get policy of FS [%v]. Error [%v]", filesystemName, err))
+	}
+	if hasFilesetPolicyRules(fset) || policyBlockRegex(filesetName, "").MatchString(policy) {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("Fileset [%v] in FS [%v] has policy rules of the driver, volumes with storagePool, encryptionKey or policyTemplate can not be migrated", filesetName, filesystemName))
+	}
+
+	isFsMounted, err := target.Conn.IsFilesystemMounted(target.Fs)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to check if FS [%v] is mounted. Error [%v]", target.Fs, err))
+	}
+	if !isFsMounted {
+		return status.Error(codes.Internal, fmt.Sprintf("Filesystem %v in cluster %v is not mounted", target.Fs, target.ClusterId))
+	}
+
+	opt := make(map[string]interface{})
+	opt[connectors.FilesetComment] = fset.Config.Comment
+	/* Parent filesets other than root are not migrated along */
+	if !fset.Config.IsInodeSpaceOwner {
+		opt[connectors.UserSpecifiedFilesetType] = dependentFileset
+		opt[connectors.UserSpecifiedParentFset] = "root"
+	} else if fset.Config.MaxNumInodes > 0 {
+		opt[connectors.UserSpecifiedInodeLimit] = strconv.Itoa(fset.Config.MaxNumInodes)
+	}
+
+	target.Fileset = filesetName
+	err = target.Conn.CreateFileset(target.Fs, target.Fileset, opt)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to create fileset [%v] in FS [%v]. Error [%v]", target.Fileset, target.Fs, err))
+	}
+
+	/* Creation of an existing fileset succeeds, make sure it was not created for another volume */
+	targetFset, err := target.Conn.ListFileset(target.Fs, target.Fileset)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", target.Fileset, target.Fs, err))
+	}
+	if !isFilesetOwner(targetFset, pvName) {
+		return status.Error(codes.AlreadyExists, fmt.Sprintf("Fileset [%v] in FS [%v] belongs to another volume", target.Fileset, target.Fs))
+	}
+
+	quota, err := conn.GetFilesetQuotaDetails(filesystemName, filesetName)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to get quota of Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+	if quota.BlockLimit > 0 || quota.FilesLimit > 0 {
+		quotaOpts := make(map[string]interface{})
+		blockLimit := ""
+		if quota.BlockLimit > 0 {
+			blockLimit = strconv.FormatUint(uint64(quota.BlockLimit)*1024, 10)
+			quotaOpts[connectors.QuotaBlockSoftLimit] = strconv.FormatUint(uint64(quota.BlockQuota)*1024, 10)
+		}
+		if quota.FilesLimit > 0 {
+			quotaOpts[connectors.UserSpecifiedFilesHardLimit] = quota.FilesLimit
+			quotaOpts[connectors.UserSpecifiedFilesSoftLimit] = quota.FilesQuota
+		}
+		err = target.Conn.CheckIfFSQuotaEnabled(target.Fs)
+		if err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("Quota not enabled for Filesystem %v inside cluster %v", target.Fs, target.ClusterId))
+		}
+		err = target.Conn.SetFilesetQuota(target.Fs, target.Fileset, blockLimit, quotaOpts)
+		if err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("Unable to set quota of Fset [%v] in FS [%v]. Error [%v]", target.Fileset, target.Fs, err))
+		}
+	}
+
+	targetDataPath, err := cs.getFilesetDataPath(target.Conn, target.Fs, target.Fileset, pvName)
+	if err != nil {
+		return err
+	}
+	err = target.Conn.MakeDirectory(target.Fs, targetDataPath, "", "", "")
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to create dir [%v] in FS [%v]. Error [%v]", targetDataPath, target.Fs, err))
+	}
+	return nil
+}
+
+// getFilesetDataPath returns the data directory of volume pvName in a
+// fileset, relative to the mount point of the filesystem.
+func (cs *ScaleControllerServer) getFilesetDataPath(conn connectors.SpectrumScaleConnector, filesystemName string, filesetName string, pvName string) (string, error) {
+	fset, err := conn.ListFileset(filesystemName, filesetName)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to list Fset [%v] in FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+	fsMountPt, err := conn.GetFilesystemMountpoint(filesystemName)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to get mount point of FS [%v]. Error [%v]", filesystemName, err))
+	}
+	linkPath := strings.Trim(strings.Replace(fset.Config.Path, fsMountPt, "", 1), "!/")
+	return fmt.Sprintf("%s/%s-data", linkPath, pvName), nil
+}
+
+// getMigratedVolumeId returns the ID of a volume migrated to target. The path
+// of the volume is the symlink in the primary fileset, so it does not change.
+func (cs *ScaleControllerServer) getMigratedVolumeId(volumeIdMembers volumeid.VolumeID, primaryConn connectors.SpectrumScaleConnector, target migrationTarget) (string, error) {
+	uid, err := primaryConn.GetFsUid(target.LocalFs)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to get FS UUID for FS [%v]. Error [%v]", target.LocalFs, err))
+	}
+	fsetUid, err := target.Conn.GetFileSetUid(target.Fs, target.Fileset)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to get Fset UID for [%v] in FS [%v]. Error [%v]", target.Fileset, target.Fs, err))
+	}
+
+	vIdMem := volumeid.VolumeID{
+		ClusterId:   target.ClusterId,
+		FsUUID:      uid,
+		FsName:      target.LocalFs,
+		VolType:     volumeid.TypeFileset,
+		FsetId:      fsetUid,
+		PathMode:    volumeIdMembers.PathMode,
+		PrimaryName: volumeIdMembers.PrimaryName,
+		SymLnkPath:  volumeIdMembers.SymLnkPath,
+	}
+	volId, err := volumeid.Encode(vIdMem)
+	if err != nil {
+		return "", status.Error(codes.Internal, fmt.Sprintf("Unable to generate volume Id for migrated volume. Error [%v]", err))
+	}
+	return volId, nil
+}
+
+// retireFileset deletes the fileset a volume was migrated from, together with
+// its scheduled snapshots and policy rules. A fileset already deleted is
+// skipped.
+func (cs *ScaleControllerServer) retireFileset(conn connectors.SpectrumScaleConnector, volumeIdMembers volumeid.VolumeID, pvName string) error {
+	filesystemName, filesetName, err := cs.GetFilesetOfVolume(conn, volumeIdMembers)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return err
+	}
+	if !cs.IsFilesetOwnedBy(conn, filesystemName, filesetName, pvName) {
+		glog.Infof("Fileset [%v] was not created for PV [%v]. Skipping delete of fileset", filesetName, pvName)
+		return nil
+	}
+
+	err = cs.DeleteScheduledSnapshots(conn, filesystemName, filesetName)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to delete scheduled snapshots of Fileset [%v] for FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+	err = cs.RemoveFilesetPolicy(conn, filesystemName, filesetName)
+	if err != nil {
+		return err
+	}
+	err = conn.DeleteFileset(filesystemName, filesetName)
+	if err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Unable to Delete Fileset [%v] for FS [%v]. Error [%v]", filesetName, filesystemName, err))
+	}
+	glog.Infof("Retired Fileset [%v] in FS [%v] after migration of volume [%v]", filesetName, filesystemName, pvName)
+	return nil
+}
@@ -17,10 +17,15 @@
 package scale
 
 import (
+	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
 	"sync"
 
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/connectors"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/settings"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/utils"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/volumeid"
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
 
@@ -55,27 +60,20 @@ func (ns *ScaleNodeServer) NodePublishVolume(ctx context.Context, req *csi.NodeP
 		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume Volume Capability must be provided")
 	}
 
-	/* <cluster_id>;<filesystem_uuid>;path=<symlink_path> */
-
-	splitVId := strings.Split(volumeID, ";")
-
-	if len(splitVId) < 3 {
-		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume VolumeID is not in proper format")
-	}
-
-	index := 2
-	if len(splitVId) == 4 {
-		index = 3
+	volumeIdMembers, err := volumeid.Decode(volumeID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("NodePublishVolume VolumeID is not in proper format. Error [%v]", err))
 	}
+	targetSlnkPath := volumeIdMembers.SymLnkPath
 
-	SlnkPart := splitVId[index]
-	targetSlnkPath := strings.Split(SlnkPart, "=")
-
-	if len(targetSlnkPath) < 2 {
-		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume VolumeID is not in proper format")
+	/* Publish the data path of the volume directly, if it is available on this node and still the data of the volume */
+	if dataPath := req.GetVolumeContext()[volCtxDataPath]; dataPath != "" {
+		if resolvedPath := ns.CheckDataPath(volumeIdMembers, dataPath); resolvedPath != "" {
+			targetSlnkPath = resolvedPath
+		}
 	}
 
-	glog.Infof("Target SpectrumScale Symlink Path : %v\n", targetSlnkPath[1])
+	glog.Infof("Target SpectrumScale Symlink Path : %v\n", targetSlnkPath)
 
 	if _, err := os.Stat(targetPath); err == nil {
 		args := []string{targetPath}
@@ -86,7 +84,7 @@ func (ns *ScaleNodeServer) NodePublishVolume(ctx context.Context, req *csi.NodeP
 		}
 	}
 
-	args := []string{"-sf", targetSlnkPath[1], targetPath}
+	args := []string{"-sf", targetSlnkPath, targetPath}
 	outputBytes, err := executeCmd("/bin/ln", args)
 	glog.Infof("Cmd /bin/ln args: %v Output: %v", args, outputBytes)
 	if err != nil {
@@ -97,6 +95,34 @@ func (ns *ScaleNodeServer) NodePublishVolume(ctx context.Context, req *csi.NodeP
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// CheckDataPath returns the resolved data path of a volume passed in its
+// volume context, or an empty path if the data path is not available on the
+// node. The data path is only used if it resolves to the same directory as
+// the path of the volume ID, the symlink in the primary fileset or the data
+// path of volumes in direct path mode. A data path left behind by a migration
+// of the volume, or any other path of the node, is not published.
+func (ns *ScaleNodeServer) CheckDataPath(volumeIdMembers volumeid.VolumeID, dataPath string) string {
+	resolvedPath, err := filepath.EvalSymlinks(dataPath)
+	if err != nil {
+		glog.Warningf("NodePublishVolume data path %v is not available, using path %v of the volume ID. Error [%v]", dataPath, volumeIdMembers.SymLnkPath, err)
+		return ""
+	}
+	volumePath, err := filepath.EvalSymlinks(volumeIdMembers.SymLnkPath)
+	if err != nil {
+		glog.Warningf("NodePublishVolume path %v of the volume ID is not available, unable to verify data path %v. Error [%v]", volumeIdMembers.SymLnkPath, dataPath, err)
+		return ""
+	}
+	if resolvedPath != volumePath {
+		glog.Warningf("NodePublishVolume data path %v resolves to %v, but path %v of the volume ID resolves to %v, using path of the volume ID", dataPath, resolvedPath, volumeIdMembers.SymLnkPath, volumePath)
+		return ""
+	}
+	if fi, err := os.Stat(resolvedPath); err != nil || !fi.IsDir() {
+		glog.Warningf("NodePublishVolume data path %v is not a directory, using path %v of the volume ID. Error [%v]", dataPath, volumeIdMembers.SymLnkPath, err)
+		return ""
+	}
+	return resolvedPath
+}
+
 func (ns *ScaleNodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
 	glog.V(3).Infof("nodeserver NodeUnpublishVolume")
 	glog.V(4).Infof("NodeUnpublishVolume called with args: %v", req)
@@ -166,10 +192,88 @@ func (ns *ScaleNodeServer) NodeGetCapabilities(ctx context.Context, req *csi.Nod
 	}, nil
 }
 
+// GetNodePrimary returns the first primary of the cluster this node belongs
+// to. The default primary is returned if the node belongs to no primary cluster.
+func (ns *ScaleNodeServer) GetNodePrimary(scalenodeID string) (settings.Primary, connectors.SpectrumScaleConnector, error) {
+	cids := getPrimaryClusterIds(ns.Driver.primaries)
+	if len(cids) > 1 {
+		for _, cid := range cids {
+			primaryConn, isConnPresent := ns.Driver.connmap[cid]
+			if !isConnPresent {
+				continue
+			}
+			_, err := primaryConn.GetNode(scalenodeID)
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			if err != nil {
+				return settings.Primary{}, nil, status.Error(codes.Internal, fmt.Sprintf("Unable to get details of node %v in cluster %v. Error [%v]", scalenodeID, cid, err))
+			}
+			for _, primary := range ns.Driver.primaries {
+				if primary.PrimaryCid == cid {
+					return primary, primaryConn, nil
+				}
+			}
+		}
+	}
+
+	primary, primaryConn, err := ns.Driver.GetPrimary("")
+	if err != nil {
+		return settings.Primary{}, nil, status.Error(codes.Internal, fmt.Sprintf("Primary connector not present in configMap. Error [%v]", err))
+	}
+	return primary, primaryConn, nil
+}
+
+// GetNodeTopology returns the topology segments of this node: the ID of the
+// primary cluster of this node and one segment for every filesystem mounted on
+// this node. Kubelet only asks for the topology when the driver registers, so
+// filesystems mounted or unmounted later are not reflected until the driver
+// restarts. ControllerPublishVolume checks the mounts of the node again.
+func (ns *ScaleNodeServer) GetNodeTopology() (map[string]string, error) {
+	scalenodeID := ns.Driver.nodeMapper.GetScaleNodeName(ns.Driver.nodeID)
+
+	primary, primaryConn, err := ns.GetNodePrimary(scalenodeID)
+	if err != nil {
+		return nil, err
+	}
+	segments := map[string]string{topologyKeyCluster: primary.PrimaryCid}
+
+	filesystems, err := primaryConn.ListFilesystems()
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to list filesystems of Primary cluster. Error [%v]", err))
+	}
+
+	for _, fsName := range filesystems {
+		mountInfo, err := primaryConn.GetFilesystemMountDetails(fsName)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to get Mount Details for FS [%v] in Primary cluster. Error [%v]", fsName, err))
+		}
+		if !utils.StringInSlice(scalenodeID, mountInfo.NodesMounted) {
+			continue
+		}
+		fsKey := getFsTopologyKey(fsName)
+		if fsKey != "" {
+			segments[fsKey] = topologyFsMounted
+		}
+	}
+
+	glog.V(4).Infof("Topology of node %s (%s): %v", ns.Driver.nodeID, scalenodeID, segments)
+	return segments, nil
+}
+
 func (ns *ScaleNodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
 	glog.V(4).Infof("NodeGetInfo called with req: %#v", req)
+
+	segments, err := ns.GetNodeTopology()
+	if err != nil {
+		return nil, err
+	}
+
 	return &csi.NodeGetInfoResponse{
 		NodeId: ns.Driver.nodeID,
+		AccessibleTopology: &csi.Topology{
+			Segments: segments,
+		},
 	}, nil
 }
 
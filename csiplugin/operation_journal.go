@@ -0,0 +1,199 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const operationJournalFile = "operations.json"
+
+const (
+	operationMigrate = "migrate"
+
+	// Steps of a volume migration, in order
+	migrateStepStarted = "started"
+	migrateStepCreated = "filesetCreated"
+	migrateStepCopied  = "dataCopied"
+	migrateStepLinked  = "symlinkSwapped"
+	migrateStepDone    = "done"
+)
+
+// migrateSteps lists the steps of a volume migration in order.
+var migrateSteps = []string{migrateStepStarted, migrateStepCreated, migrateStepCopied, migrateStepLinked, migrateStepDone}
+
+// operationEntry records the progress of a long running operation on a volume.
+type operationEntry struct {
+	Operation     string    `json:"operation"`
+	VolumeID      string    `json:"volumeId"`
+	TargetCluster string    `json:"targetCluster,omitempty"`
+	TargetFs      string    `json:"targetFs,omitempty"`
+	TargetFileset string    `json:"targetFileset,omitempty"`
+	NewVolumeID   string    `json:"newVolumeId,omitempty"`
+	Step          string    `json:"step"`
+	Error         string    `json:"error,omitempty"`
+	Updated       time.Time `json:"updated"`
+}
+
+// reached returns true if the operation completed step.
+func (e operationEntry) reached(step string) bool {
+	for _, s := range migrateSteps {
+		if s == step {
+			return true
+		}
+		if s == e.Step {
+			return false
+		}
+	}
+	return false
+}
+
+// operationJournal keeps track of the steps completed by operations which
+// span several requests to Spectrum Scale, so that an interrupted operation
+// is resumed where it stopped. Completed migrations stay recorded, so that
+// the volume ID a volume was migrated from is resolved by the controller
+// service of every node. The journal is read from its store for every
+// operation.
+type operationJournal struct {
+	store recordStore
+}
+
+func newOperationJournal(store recordStore) *operationJournal {
+	return &operationJournal{store: store}
+}
+
+func operationKey(operation string, volumeID string) string {
+	return operation + ":" + volumeID
+}
+
+func decodeOperationEntries(data []byte) (map[string]operationEntry, error) {
+	entries := make(map[string]operationEntry)
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse operation journal: %v", err)
+		}
+	}
+	return entries, nil
+}
+
+func (j *operationJournal) load() (map[string]operationEntry, error) {
+	data, err := j.store.Read()
+	if err != nil {
+		return nil, err
+	}
+	return decodeOperationEntries(data)
+}
+
+func (j *operationJournal) update(modify func(entries map[string]operationEntry)) error {
+	return j.store.Update(func(data []byte) ([]byte, error) {
+		entries, err := decodeOperationEntries(data)
+		if err != nil {
+			return nil, err
+		}
+		modify(entries)
+		return json.MarshalIndent(entries, "", " ")
+	})
+}
+
+// Get returns the entry of operation on volumeID.
+func (j *operationJournal) Get(operation string, volumeID string) (operationEntry, bool, error) {
+	entries, err := j.load()
+	if err != nil {
+		return operationEntry{}, false, err
+	}
+	entry, ok := entries[operationKey(operation, volumeID)]
+	return entry, ok, nil
+}
+
+// Record stores entry, replacing the previous entry of the operation.
+func (j *operationJournal) Record(entry operationEntry) error {
+	entry.Updated = time.Now().UTC()
+	return j.update(func(entries map[string]operationEntry) {
+		entries[operationKey(entry.Operation, entry.VolumeID)] = entry
+	})
+}
+
+// Remove removes the entry of operation on volumeID.
+func (j *operationJournal) Remove(operation string, volumeID string) error {
+	return j.update(func(entries map[string]operationEntry) {
+		delete(entries, operationKey(operation, volumeID))
+	})
+}
+
+// RemoveVolume removes the entries of operations on volumeID, and of the
+// migrations volumeID was migrated from or to, once the volume is deleted.
+func (j *operationJournal) RemoveVolume(volumeID string) error {
+	entries, err := j.load()
+	if err != nil {
+		return err
+	}
+	if keys, _ := connectedEntries(entries, volumeID); len(keys) == 0 {
+		return nil
+	}
+	return j.update(func(entries map[string]operationEntry) {
+		keys, _ := connectedEntries(entries, volumeID)
+		for _, key := range keys {
+			delete(entries, key)
+		}
+	})
+}
+
+// GetVolumeIds returns volumeID and the IDs the volume had before or after
+// its migrations.
+func (j *operationJournal) GetVolumeIds(volumeID string) ([]string, error) {
+	entries, err := j.load()
+	if err != nil {
+		return nil, err
+	}
+	_, volumeIDs := connectedEntries(entries, volumeID)
+	return volumeIDs, nil
+}
+
+// connectedEntries returns the keys of the entries of volumeID and of the
+// volume IDs it is connected to by migrations, and these volume IDs.
+func connectedEntries(entries map[string]operationEntry, volumeID string) ([]string, []string) {
+	volumeIDs := map[string]bool{volumeID: true}
+	keys := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for key, entry := range entries {
+			if keys[key] || !volumeIDs[entry.VolumeID] && !volumeIDs[entry.NewVolumeID] {
+				continue
+			}
+			keys[key] = true
+			volumeIDs[entry.VolumeID] = true
+			if entry.NewVolumeID != "" {
+				volumeIDs[entry.NewVolumeID] = true
+			}
+			changed = true
+		}
+	}
+
+	var keyList, volumeIDList []string
+	for key := range keys {
+		keyList = append(keyList, key)
+	}
+	for id := range volumeIDs {
+		volumeIDList = append(volumeIDList, id)
+	}
+	sort.Strings(volumeIDList)
+	return keyList, volumeIDList
+}
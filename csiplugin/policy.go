@@ -0,0 +1,202 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/connectors"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/settings"
+	"github.com/golang/glog"
+)
+
+// Policy rules installed by the driver are kept in blocks delimited by
+// marker comments, one block per fileset and kind of rule:
+//
+//	/* CSI-BEGIN <fileset> <kind> */
+//	RULE ...
+//	/* CSI-END <fileset> <kind> */
+//
+// Blocks are inserted at the top of the filesystem policy, so that they are
+// evaluated before the rules of the administrator.
+const (
+	policyKindPlacement  = "placement"
+	policyKindEncryption = "encryption"
+	policyKindTemplate   = "template"
+
+	// Placement rule added when the filesystem policy has none, files not
+	// matching a fileset rule are placed in the system pool.
+	defaultPlacementRule = "/* CSI-DEFAULT */\nRULE 'default' SET POOL 'system'"
+
+	// Placement rule of a filesystem without policy, installed when removing
+	// the last rules of the driver leaves no rule.
+	systemPlacementRule = "RULE 'DEFAULT' SET POOL 'system'"
+)
+
+var placementRuleRegex = regexp.MustCompile(`(?i)\bSET\s+POOL\b`)
+
+var defaultPlacementRuleRegex = regexp.MustCompile(regexp.QuoteMeta(defaultPlacementRule) + `\n?`)
+
+var policyTemplateNameRegex = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+// policyTemplateParams are the fields available in policy templates.
+type policyTemplateParams struct {
+	Fileset    string
+	Filesystem string
+	PVName     string
+	PVCName    string
+	Namespace  string
+}
+
+// policyBlockRegex matches the rule blocks of fileset and kind, an empty
+// fileset or kind matches any.
+func policyBlockRegex(fileset string, kind string) *regexp.Regexp {
+	filesetExpr, kindExpr := `\S+`, `\S+`
+	if fileset != "" {
+		filesetExpr = regexp.QuoteMeta(fileset)
+	}
+	if kind != "" {
+		kindExpr = regexp.QuoteMeta(kind)
+	}
+	return regexp.MustCompile(fmt.Sprintf(`(?s)/\* CSI-BEGIN %[1]s %[2]s \*/.*?/\* CSI-END %[1]s %[2]s \*/\n?`, filesetExpr, kindExpr))
+}
+
+// removePolicyBlocks removes the rules of fileset from policy. All kinds of
+// rules are removed if kind is empty.
+func removePolicyBlocks(policy string, fileset string, kind string) string {
+	return policyBlockRegex(fileset, kind).ReplaceAllString(policy, "")
+}
+
+// removeFilesetPolicy removes the rules of fileset from policy, together with
+// the default placement rule once no fileset has rules.
+func removeFilesetPolicy(policy string, fileset string, kind string) string {
+	newPolicy := removePolicyBlocks(policy, fileset, kind)
+	if newPolicy == policy || policyBlockRegex("", "").MatchString(newPolicy) {
+		return newPolicy
+	}
+
+	newPolicy = defaultPlacementRuleRegex.ReplaceAllString(newPolicy, "")
+	if strings.TrimSpace(newPolicy) == "" {
+		return systemPlacementRule + "\n"
+	}
+	return newPolicy
+}
+
+// setPolicyBlock replaces the rules of the given kind for fileset in policy.
+func setPolicyBlock(policy string, fileset string, kind string, rules string) string {
+	policy = removePolicyBlocks(policy, fileset, kind)
+
+	adminPolicy := policyBlockRegex("", "").ReplaceAllString(policy, "")
+	if !placementRuleRegex.MatchString(adminPolicy) {
+		policy = strings.TrimRight(policy, "\n") + "\n" + defaultPlacementRule + "\n"
+	}
+
+	block := fmt.Sprintf("/* CSI-BEGIN %[1]s %[2]s */\n%[3]s\n/* CSI-END %[1]s %[2]s */\n", fileset, kind, strings.TrimSpace(rules))
+	return block + strings.TrimLeft(policy, "\n")
+}
+
+// getPlacementRule returns a rule placing the data of fileset in pool.
+func getPlacementRule(fileset string, pool string) string {
+	return fmt.Sprintf("RULE 'csi-%[1]s-placement' SET POOL '%[2]s' FOR FILESET ('%[1]s')", fileset, pool)
+}
+
+// getEncryptionRules returns the rules encrypting new files of fileset with
+// algo and keys.
+func getEncryptionRules(fileset string, algo string, keys []string) string {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = fmt.Sprintf("'%s'", key)
+	}
+	return fmt.Sprintf("RULE 'csi-%[1]s-encspec' ENCRYPTION 'csi-%[1]s' IS ALGO '%[2]s' KEYS(%[3]s)\n"+
+		"RULE 'csi-%[1]s-encryption' SET ENCRYPTION 'csi-%[1]s' FOR FILESET ('%[1]s')", fileset, algo, strings.Join(quoted, ","))
+}
+
+func parsePolicyTemplate(tpl settings.PolicyTemplate) (*template.Template, error) {
+	return template.New(tpl.Name).Option("missingkey=error").Parse(tpl.Rules)
+}
+
+// validatePolicyTemplates checks the names and rules of the policy templates
+// of the driver configuration.
+func validatePolicyTemplates(templates []settings.PolicyTemplate) error {
+	names := make(map[string]bool)
+	for _, tpl := range templates {
+		if !policyTemplateNameRegex.MatchString(tpl.Name) {
+			return fmt.Errorf("Invalid name %q specified for policy template", tpl.Name)
+		}
+		if names[tpl.Name] {
+			return fmt.Errorf("More than one policy template named %s specified", tpl.Name)
+		}
+		names[tpl.Name] = true
+		if strings.TrimSpace(tpl.Rules) == "" {
+			return fmt.Errorf("No rules specified for policy template %s", tpl.Name)
+		}
+		if _, err := parsePolicyTemplate(tpl); err != nil {
+			return fmt.Errorf("Invalid rules specified for policy template %s: %v", tpl.Name, err)
+		}
+	}
+	return nil
+}
+
+// renderPolicyTemplate returns the rules of tpl for the fileset in params.
+func renderPolicyTemplate(tpl settings.PolicyTemplate, params policyTemplateParams) (string, error) {
+	t, err := parsePolicyTemplate(tpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, params)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// UpdateFilesetPolicy installs rules of the given kind for fileset in the
+// policy of filesystem fsName. Empty rules remove the rules of that kind, an
+// empty kind together with empty rules removes all rules of the fileset.
+func (cs *ScaleControllerServer) UpdateFilesetPolicy(conn connectors.SpectrumScaleConnector, fsName string, fileset string, kind string, rules string) error {
+	cs.Driver.policyMux.Lock()
+	defer cs.Driver.policyMux.Unlock()
+
+	policy, err := conn.GetFilesystemPolicy(fsName)
+	if err != nil {
+		return fmt.Errorf("unable to get policy of filesystem %s: %v", fsName, err)
+	}
+
+	var newPolicy string
+	if rules == "" {
+		newPolicy = removeFilesetPolicy(policy, fileset, kind)
+	} else {
+		newPolicy = setPolicyBlock(policy, fileset, kind, rules)
+	}
+
+	if newPolicy == policy {
+		glog.V(4).Infof("Policy of filesystem %s is up to date for fileset %s", fsName, fileset)
+		return nil
+	}
+
+	glog.Infof("Updating %s policy rules of fileset %s in filesystem %s", kind, fileset, fsName)
+	err = conn.SetFilesystemPolicy(fsName, newPolicy)
+	if err != nil {
+		return fmt.Errorf("unable to set policy of filesystem %s: %v", fsName, err)
+	}
+	return nil
+}
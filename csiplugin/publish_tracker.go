@@ -0,0 +1,246 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const publishTrackerFile = "published-volumes.json"
+
+// publishedFs records the volumes published on a node from one filesystem.
+type publishedFs struct {
+	Volumes []string `json:"volumes"`
+	// MountedByDriver is set if the filesystem was mounted on the node by the driver.
+	MountedByDriver bool `json:"mountedByDriver"`
+}
+
+func (pfs *publishedFs) hasVolume(volID string) bool {
+	for _, v := range pfs.Volumes {
+		if v == volID {
+			return true
+		}
+	}
+	return false
+}
+
+type publishRecord struct {
+	// Nodes maps node name -> filesystem name -> published volumes
+	Nodes map[string]map[string]*publishedFs `json:"nodes"`
+	// Mounts maps node name -> filesystem name -> options of mounts done by the driver
+	Mounts map[string]map[string]string `json:"mounts"`
+}
+
+// publishTracker keeps track of the volumes published per node and filesystem,
+// so that a filesystem mounted by the driver can be unmounted when its last
+// volume is unpublished. The record is read from its store for every
+// operation, as the controller service of any node may publish volumes.
+type publishTracker struct {
+	mux   sync.Mutex
+	locks map[string]*sync.Mutex
+	store recordStore
+}
+
+func newPublishTracker(store recordStore) *publishTracker {
+	return &publishTracker{
+		locks: make(map[string]*sync.Mutex),
+		store: store,
+	}
+}
+
+// lockNodeFs serializes publish and unpublish operations for a filesystem on a
+// node. The returned function releases the lock.
+func (t *publishTracker) lockNodeFs(node string, fs string) func() {
+	key := node + ":" + fs
+	t.mux.Lock()
+	l, ok := t.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		t.locks[key] = l
+	}
+	t.mux.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+func decodePublishRecord(data []byte) (publishRecord, error) {
+	record := publishRecord{}
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &record)
+		if err != nil {
+			return publishRecord{}, fmt.Errorf("Unable to parse published volumes: %v", err)
+		}
+	}
+	if record.Nodes == nil {
+		record.Nodes = make(map[string]map[string]*publishedFs)
+	}
+	if record.Mounts == nil {
+		record.Mounts = make(map[string]map[string]string)
+	}
+	return record, nil
+}
+
+func (t *publishTracker) load() (publishRecord, error) {
+	data, err := t.store.Read()
+	if err != nil {
+		return publishRecord{}, err
+	}
+	return decodePublishRecord(data)
+}
+
+func (t *publishTracker) update(modify func(record *publishRecord)) error {
+	return t.store.Update(func(data []byte) ([]byte, error) {
+		record, err := decodePublishRecord(data)
+		if err != nil {
+			return nil, err
+		}
+		modify(&record)
+		return json.MarshalIndent(record, "", " ")
+	})
+}
+
+// AddVolume records volID as published on node from filesystem fs.
+func (t *publishTracker) AddVolume(node string, fs string, volID string, mountedByDriver bool) error {
+	return t.update(func(record *publishRecord) {
+		fsmap, ok := record.Nodes[node]
+		if !ok {
+			fsmap = make(map[string]*publishedFs)
+			record.Nodes[node] = fsmap
+		}
+		pfs, ok := fsmap[fs]
+		if !ok {
+			pfs = &publishedFs{}
+			fsmap[fs] = pfs
+		}
+		pfs.MountedByDriver = pfs.MountedByDriver || mountedByDriver
+		for _, v := range pfs.Volumes {
+			if v == volID {
+				return
+			}
+		}
+		pfs.Volumes = append(pfs.Volumes, volID)
+	})
+}
+
+// IsLastVolume returns true if volID is the only volume published on node from
+// filesystem fs, and whether the filesystem was mounted by the driver.
+func (t *publishTracker) IsLastVolume(node string, fs string, volID string) (bool, bool, error) {
+	record, err := t.load()
+	if err != nil {
+		return false, false, err
+	}
+
+	pfs, ok := record.Nodes[node][fs]
+	if !ok {
+		return false, false, nil
+	}
+	if len(pfs.Volumes) == 1 && pfs.Volumes[0] == volID {
+		return true, pfs.MountedByDriver, nil
+	}
+	return false, pfs.MountedByDriver, nil
+}
+
+// GetVolumeNodes returns the nodes volID is published on.
+func (t *publishTracker) GetVolumeNodes(volID string) ([]string, error) {
+	record, err := t.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []string
+	for node, fsmap := range record.Nodes {
+		for _, pfs := range fsmap {
+			if pfs.hasVolume(volID) {
+				nodes = append(nodes, node)
+				break
+			}
+		}
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// RemoveVolume removes volID from the volumes published on node from filesystem fs.
+func (t *publishTracker) RemoveVolume(node string, fs string, volID string) error {
+	return t.update(func(record *publishRecord) {
+		fsmap, ok := record.Nodes[node]
+		if !ok {
+			return
+		}
+		pfs, ok := fsmap[fs]
+		if !ok {
+			return
+		}
+
+		var volumes []string
+		for _, v := range pfs.Volumes {
+			if v != volID {
+				volumes = append(volumes, v)
+			}
+		}
+		pfs.Volumes = volumes
+
+		if len(pfs.Volumes) == 0 {
+			delete(fsmap, fs)
+		}
+		if len(fsmap) == 0 {
+			delete(record.Nodes, node)
+		}
+	})
+}
+
+// SetMountOptions records that the driver mounted filesystem fs on node with mountOptions.
+func (t *publishTracker) SetMountOptions(node string, fs string, mountOptions string) error {
+	return t.update(func(record *publishRecord) {
+		fsmap, ok := record.Mounts[node]
+		if !ok {
+			fsmap = make(map[string]string)
+			record.Mounts[node] = fsmap
+		}
+		fsmap[fs] = mountOptions
+	})
+}
+
+// GetMountOptions returns the options with which the driver mounted filesystem
+// fs on node. It returns false if the filesystem was not mounted by the driver.
+func (t *publishTracker) GetMountOptions(node string, fs string) (string, bool, error) {
+	record, err := t.load()
+	if err != nil {
+		return "", false, err
+	}
+
+	mountOptions, ok := record.Mounts[node][fs]
+	return mountOptions, ok, nil
+}
+
+// ClearMountOptions removes the mount record of filesystem fs on node.
+func (t *publishTracker) ClearMountOptions(node string, fs string) error {
+	return t.update(func(record *publishRecord) {
+		fsmap, ok := record.Mounts[node]
+		if !ok {
+			return
+		}
+		delete(fsmap, fs)
+		if len(fsmap) == 0 {
+			delete(record.Mounts, node)
+		}
+	})
+}
@@ -0,0 +1,190 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/utils"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// recordStore persists a record of the controller service, like the volumes
+// published per node. Records are JSON documents.
+type recordStore interface {
+	// Read returns the stored record, or nil if no record is stored.
+	Read() ([]byte, error)
+	// Update stores the record returned by modify for the stored record, nil
+	// if no record is stored. modify is called again if the record was
+	// changed concurrently by another instance of the driver.
+	Update(modify func(record []byte) ([]byte, error)) error
+}
+
+// fileRecordStore keeps the record in a file of the plugin folder of the node.
+type fileRecordStore struct {
+	mux      sync.Mutex
+	dir      string
+	fileName string
+}
+
+func newFileRecordStore(dir string, fileName string) *fileRecordStore {
+	return &fileRecordStore{dir: dir, fileName: fileName}
+}
+
+func (s *fileRecordStore) Read() ([]byte, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.read()
+}
+
+func (s *fileRecordStore) read() ([]byte, error) {
+	filePath := path.Join(s.dir, s.fileName)
+	if !utils.Exists(filePath) {
+		return nil, nil
+	}
+	return utils.ReadFile(filePath)
+}
+
+func (s *fileRecordStore) Update(modify func(record []byte) ([]byte, error)) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	record, err := s.read()
+	if err != nil {
+		return err
+	}
+	record, err = modify(record)
+	if err != nil {
+		return err
+	}
+	_ = utils.MkDir(s.dir)
+	return utils.WriteFile(path.Join(s.dir, s.fileName), record)
+}
+
+// ConfigMaps are limited to 1MiB including their metadata. Updates by the
+// driver instances of all nodes conflict, they are retried for several seconds.
+const configMapRecordMaxSize = 1000 * 1024
+
+var configMapRecordBackoff = wait.Backoff{
+	Steps:    10,
+	Duration: 20 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.5,
+	Cap:      2 * time.Second,
+}
+
+// configMapRecordStore keeps the record in a ConfigMap, so that it is shared
+// by the driver instances of all nodes. Concurrent updates are detected by the
+// resource version of the ConfigMap. A record found in legacy, the store used
+// by earlier versions of the driver, is read until the ConfigMap is created.
+type configMapRecordStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	key       string
+	legacy    recordStore
+}
+
+func newConfigMapRecordStore(client kubernetes.Interface, namespace string, name string, key string, legacy recordStore) *configMapRecordStore {
+	return &configMapRecordStore{client: client, namespace: namespace, name: name, key: key, legacy: legacy}
+}
+
+func (s *configMapRecordStore) Read() ([]byte, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return s.readLegacy()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get ConfigMap %s/%s: %v", s.namespace, s.name, err)
+	}
+	return []byte(cm.Data[s.key]), nil
+}
+
+func (s *configMapRecordStore) readLegacy() ([]byte, error) {
+	if s.legacy == nil {
+		return nil, nil
+	}
+	record, err := s.legacy.Read()
+	if err != nil {
+		glog.Errorf("Unable to read record %s of previous driver version, ignoring it: %v", s.key, err)
+		return nil, nil
+	}
+	return record, nil
+}
+
+func (s *configMapRecordStore) Update(modify func(record []byte) ([]byte, error)) error {
+	isConflict := func(err error) bool {
+		return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+	}
+	return retry.OnError(configMapRecordBackoff, isConflict, func() error {
+		configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+		cm, err := configMaps.Get(s.name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			record, err := s.readLegacy()
+			if err != nil {
+				return err
+			}
+			record, err = modify(record)
+			if err != nil {
+				return err
+			}
+			if err := s.checkSize(record); err != nil {
+				return err
+			}
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+				Data:       map[string]string{s.key: string(record)},
+			}
+			_, err = configMaps.Create(cm)
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to get ConfigMap %s/%s: %v", s.namespace, s.name, err)
+		}
+
+		record, err := modify([]byte(cm.Data[s.key]))
+		if err != nil {
+			return err
+		}
+		if err := s.checkSize(record); err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[s.key] = string(record)
+		_, err = configMaps.Update(cm)
+		return err
+	})
+}
+
+// checkSize refuses records that do not fit into the ConfigMap.
+func (s *configMapRecordStore) checkSize(record []byte) error {
+	if len(record) > configMapRecordMaxSize {
+		return fmt.Errorf("Record %s of %d bytes exceeds the limit of %d bytes of ConfigMap %s/%s", s.key, len(record), configMapRecordMaxSize, s.namespace, s.name)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package settings
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	ConfigSourceFile       string = "file"
+	ConfigSourceKubernetes string = "kubernetes"
+
+	DefaultConfigMapName string = "spectrum-scale-config"
+	ConfigMapKey         string = "spectrum-scale-config.json"
+
+	serviceAccountNamespaceFile string        = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	kubeInformerResync          time.Duration = 10 * time.Minute
+	kubeCacheSyncTimeout        time.Duration = 2 * time.Minute
+)
+
+// KubeConfigSource reads the configuration from a ConfigMap, and the secrets
+// and CA certificates referenced by it, from the Kubernetes API. Secrets hold
+// the keys "username" and "password". CA certificates are ConfigMaps holding
+// the certificate under the key named like the ConfigMap, or as their only key.
+type KubeConfigSource struct {
+	namespace      string
+	configMapName  string
+	configMaps     listerscorev1.ConfigMapNamespaceLister
+	secrets        listerscorev1.SecretNamespaceLister
+	cmInformer     cache.SharedIndexInformer
+	secretInformer cache.SharedIndexInformer
+}
+
+// NewKubeConfigSource starts informers for the ConfigMaps and Secrets of
+// namespace and waits for their caches to be filled. An empty kubeconfig uses
+// the in-cluster configuration, an empty namespace the namespace of the pod.
+func NewKubeConfigSource(kubeconfig string, namespace string, configMapName string) (*KubeConfigSource, error) {
+	glog.V(5).Infof("kube_config NewKubeConfigSource. namespace: %s, configMap: %s", namespace, configMapName)
+
+	namespace, err := GetNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewKubeClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(client, kubeInformerResync, informers.WithNamespace(namespace))
+	configMaps := factory.Core().V1().ConfigMaps()
+	secrets := factory.Core().V1().Secrets()
+
+	s := &KubeConfigSource{
+		namespace:      namespace,
+		configMapName:  configMapName,
+		configMaps:     configMaps.Lister().ConfigMaps(namespace),
+		secrets:        secrets.Lister().Secrets(namespace),
+		cmInformer:     configMaps.Informer(),
+		secretInformer: secrets.Informer(),
+	}
+
+	// Informers run for the lifetime of the driver
+	factory.Start(make(chan struct{}))
+
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(kubeCacheSyncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+	if !cache.WaitForCacheSync(timeout, s.cmInformer.HasSynced, s.secretInformer.HasSynced) {
+		return nil, fmt.Errorf("Timed out waiting for ConfigMaps and Secrets of namespace %s", namespace)
+	}
+	return s, nil
+}
+
+// NewKubeClient returns a client of the Kubernetes API. An empty kubeconfig
+// uses the in-cluster configuration.
+func NewKubeClient(kubeconfig string) (kubernetes.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get kubernetes client configuration: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create kubernetes client: %v", err)
+	}
+	return client, nil
+}
+
+// GetNamespace returns namespace, or the namespace of the pod of the driver if
+// namespace is empty.
+func GetNamespace(namespace string) (string, error) {
+	if namespace != "" {
+		return namespace, nil
+	}
+	content, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return "", fmt.Errorf("Unable to get namespace of the driver, specify the namespace of the configuration: %v", err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (s *KubeConfigSource) Load() (ScaleSettingsConfigMap, error) {
+	glog.V(5).Infof("kube_config Load")
+
+	cm, err := s.configMaps.Get(s.configMapName)
+	if err != nil {
+		return ScaleSettingsConfigMap{}, fmt.Errorf("Spectrum Scale configuration not found: %v", err)
+	}
+	content, ok := cm.Data[ConfigMapKey]
+	if !ok {
+		return ScaleSettingsConfigMap{}, fmt.Errorf("Spectrum Scale configuration not found: ConfigMap %s/%s has no key %s", s.namespace, s.configMapName, ConfigMapKey)
+	}
+	cmsj, err := ParseScaleConfig([]byte(content))
+	if err != nil {
+		return ScaleSettingsConfigMap{}, err
+	}
+
+	readSecret := func(name string, key string) ([]byte, error) {
+		secret, err := s.secrets.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := secret.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("Secret %s/%s has no key %s", s.namespace, name, key)
+		}
+		return value, nil
+	}
+	readCert := func(name string) ([]byte, error) {
+		cm, err := s.configMaps.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := cm.Data[name]; ok {
+			return []byte(value), nil
+		}
+		if len(cm.Data) == 1 {
+			for _, value := range cm.Data {
+				return []byte(value), nil
+			}
+		}
+		return nil, fmt.Errorf("ConfigMap %s/%s has no key %s", s.namespace, name, name)
+	}
+
+	err = resolveSecretsAndCerts(&cmsj, readSecret, readCert)
+	if err != nil {
+		return ScaleSettingsConfigMap{}, fmt.Errorf("Error in secrets or certificates: %v", err)
+	}
+	return cmsj, nil
+}
+
+// Watch reloads the configuration on every change of a ConfigMap or Secret in
+// the namespace. A configuration which fails to load is ignored.
+func (s *KubeConfigSource) Watch(onChange func(ScaleSettingsConfigMap), stop <-chan struct{}) {
+	var mux sync.Mutex
+	stopped := false
+	last, err := s.Load()
+	if err != nil {
+		glog.Errorf("Unable to load Spectrum Scale configuration: %v", err)
+	}
+
+	reload := func(obj interface{}) {
+		mux.Lock()
+		defer mux.Unlock()
+		if stopped {
+			return
+		}
+
+		scaleConfig, err := s.Load()
+		if err != nil {
+			glog.Errorf("Unable to reload Spectrum Scale configuration, keeping previous configuration: %v", err)
+			return
+		}
+		if reflect.DeepEqual(scaleConfig, last) {
+			return
+		}
+		last = scaleConfig
+		glog.Infof("Spectrum Scale configuration changed")
+		onChange(scaleConfig)
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    reload,
+		UpdateFunc: func(oldObj, newObj interface{}) { reload(newObj) },
+		DeleteFunc: reload,
+	}
+	s.cmInformer.AddEventHandler(handler)
+	s.secretInformer.AddEventHandler(handler)
+
+	<-stop
+	mux.Lock()
+	stopped = true
+	mux.Unlock()
+}
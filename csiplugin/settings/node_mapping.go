@@ -0,0 +1,211 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/utils"
+	"github.com/golang/glog"
+)
+
+const (
+	NodeMappingFile           string        = "/var/lib/ibm/nodemapping/node-mapping.json"
+	NodeMappingReloadInterval time.Duration = 30 * time.Second
+
+	nodeMappingNotFound string = "NOT_FOUND"
+)
+
+// NodeMappingRule rewrites kubernetes node names matching Match to Replace.
+// Replace can refer to submatches of Match, e.g. "$1".
+type NodeMappingRule struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+
+	regex *regexp.Regexp
+}
+
+// NodeMapping maps kubernetes node names to Spectrum Scale admin node names.
+type NodeMapping struct {
+	Nodes         map[string]string `json:"nodes"`
+	Rules         []NodeMappingRule `json:"rules"`
+	DefaultDomain string            `json:"defaultDomain"`
+}
+
+// NodeMapper resolves kubernetes node names using the node mapping file and
+// reloads the file when it changes.
+type NodeMapper struct {
+	mux      sync.RWMutex
+	path     string
+	content  []byte
+	mapping  NodeMapping
+	validate func(NodeMapping) error
+}
+
+func LoadNodeMapping(content []byte) (NodeMapping, error) {
+	glog.V(5).Infof("node_mapping LoadNodeMapping")
+
+	mapping := NodeMapping{}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return mapping, nil
+	}
+
+	err := json.Unmarshal(content, &mapping)
+	if err != nil {
+		return NodeMapping{}, fmt.Errorf("Error in unmarshalling node mapping json: %v", err)
+	}
+
+	for i := 0; i < len(mapping.Rules); i++ {
+		if mapping.Rules[i].Match == "" {
+			return NodeMapping{}, fmt.Errorf("Node mapping rule %d has no match expression", i)
+		}
+		regex, err := regexp.Compile(mapping.Rules[i].Match)
+		if err != nil {
+			return NodeMapping{}, fmt.Errorf("Invalid match expression %s in node mapping rule %d: %v", mapping.Rules[i].Match, i, err)
+		}
+		mapping.Rules[i].regex = regex
+	}
+	mapping.DefaultDomain = strings.Trim(mapping.DefaultDomain, ".")
+
+	return mapping, nil
+}
+
+func readNodeMappingFile(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return content, nil
+}
+
+// NewNodeMapper loads the node mapping file from path. A missing file results
+// in an empty mapping. validate is invoked for every loaded mapping, a mapping
+// which fails validation is not used.
+func NewNodeMapper(path string, validate func(NodeMapping) error) (*NodeMapper, error) {
+	glog.V(5).Infof("node_mapping NewNodeMapper. path: %s", path)
+
+	mapper := &NodeMapper{path: path, validate: validate}
+	_, err := mapper.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return mapper, nil
+}
+
+// Reload reads the node mapping file again. It returns true if the mapping changed.
+func (m *NodeMapper) Reload() (bool, error) {
+	content, err := readNodeMappingFile(m.path)
+	if err != nil {
+		return false, fmt.Errorf("Unable to read node mapping file %s: %v", m.path, err)
+	}
+
+	m.mux.RLock()
+	unchanged := m.content != nil && bytes.Equal(content, m.content)
+	m.mux.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	mapping, err := LoadNodeMapping(content)
+	if err != nil {
+		return false, err
+	}
+
+	if m.validate != nil {
+		err = m.validate(mapping)
+		if err != nil {
+			return false, fmt.Errorf("Node mapping validation failed: %v", err)
+		}
+	}
+
+	if content == nil {
+		content = []byte{}
+	}
+
+	m.mux.Lock()
+	m.content = content
+	m.mapping = mapping
+	m.mux.Unlock()
+
+	glog.Infof("Loaded node mapping: %d nodes, %d rules, default domain %q", len(mapping.Nodes), len(mapping.Rules), mapping.DefaultDomain)
+	return true, nil
+}
+
+// Watch reloads the node mapping file every interval until stop is closed.
+func (m *NodeMapper) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, err := m.Reload()
+			if err != nil {
+				glog.Errorf("Unable to reload node mapping, keeping previous mapping: %v", err)
+			}
+		}
+	}
+}
+
+// GetScaleNodeName returns the Spectrum Scale node name for a kubernetes node.
+// Exact mappings take precedence, followed by the deprecated environment
+// variable mapping, the rewrite rules and the default domain.
+func (m *NodeMapper) GetScaleNodeName(nodeID string) string {
+	m.mux.RLock()
+	mapping := m.mapping
+	m.mux.RUnlock()
+
+	if scalenodeID, ok := mapping.Nodes[nodeID]; ok && scalenodeID != "" {
+		return scalenodeID
+	}
+
+	scalenodeID := utils.GetEnv(nodeID, nodeMappingNotFound)
+	// Additional node mapping check in case of k8s node id start with number.
+	if scalenodeID == nodeMappingNotFound {
+		prefix := utils.GetEnv("SCALE_NODE_MAPPING_PREFIX", "K8sNodePrefix_")
+		scalenodeID = utils.GetEnv(prefix+nodeID, nodeMappingNotFound)
+	}
+	if scalenodeID != nodeMappingNotFound {
+		return scalenodeID
+	}
+
+	for _, rule := range mapping.Rules {
+		if rule.regex != nil && rule.regex.MatchString(nodeID) {
+			return rule.regex.ReplaceAllString(nodeID, rule.Replace)
+		}
+	}
+
+	if mapping.DefaultDomain != "" && !strings.Contains(nodeID, ".") {
+		return nodeID + "." + mapping.DefaultDomain
+	}
+
+	glog.V(4).Infof("scale node mapping not found for %s", nodeID)
+	return nodeID
+}
@@ -27,10 +27,20 @@ import (
 )
 
 type ScaleSettingsConfigMap struct {
-	Clusters []Clusters
+	Clusters        []Clusters
+	PolicyTemplates []PolicyTemplate `json:"policyTemplates,omitempty"`
+}
+
+// PolicyTemplate is a named set of policy rules which storageClasses attach to
+// the filesets of their volumes. Rules is a Go template rendered for each
+// fileset.
+type PolicyTemplate struct {
+	Name  string `json:"name"`
+	Rules string `json:"rules"`
 }
 
 type Primary struct {
+	Name          string `json:"name"`
 	PrimaryFSDep  string `json:"primaryFS"` // Deprecated
 	PrimaryFs     string `json:"primaryFs"`
 	PrimaryFset   string `json:"primaryFset"`
@@ -74,24 +84,45 @@ func (primary Primary) GetInodeLimit() string {
 	return primary.InodeLimits
 }
 
+// QuotaGracePeriod sets the grace periods of the fileset quotas of a
+// filesystem of the cluster, e.g. "7 days". Grace periods apply to all
+// fileset quotas of the filesystem.
+type QuotaGracePeriod struct {
+	Filesystem       string `json:"filesystem"`
+	BlockGracePeriod string `json:"blockGracePeriod,omitempty"`
+	FilesGracePeriod string `json:"filesGracePeriod,omitempty"`
+}
+
 type RestAPI struct {
 	GuiHost string `json:"guiHost"`
 	GuiPort int    `json:"guiPort"`
 }
 
 type Clusters struct {
-	ID            string    `json:"id"`
-	Primary       Primary   `json:"primary,omitempty"`
-	SecureSslMode bool      `json:"secureSslMode"`
-	Cacert        string    `json:"cacert"`
-	Secrets       string    `json:"secrets"`
-	RestAPI       []RestAPI `json:"restApi"`
+	ID                string             `json:"id"`
+	Primary           Primary            `json:"primary,omitempty"`
+	Primaries         []Primary          `json:"primaries,omitempty"`
+	SecureSslMode     bool               `json:"secureSslMode"`
+	Cacert            string             `json:"cacert"`
+	Secrets           string             `json:"secrets"`
+	RestAPI           []RestAPI          `json:"restApi"`
+	QuotaGracePeriods []QuotaGracePeriod `json:"quotaGracePeriods,omitempty"`
 
 	MgmtUsername string
 	MgmtPassword string
 	CacertValue  []byte
 }
 
+// GetPrimaries returns the primary definitions of a cluster, the primary
+// followed by the named primaries.
+func (cluster Clusters) GetPrimaries() []Primary {
+	var primaries []Primary
+	if cluster.Primary != (Primary{}) {
+		primaries = append(primaries, cluster.Primary)
+	}
+	return append(primaries, cluster.Primaries...)
+}
+
 const (
 	DefaultGuiPort  int    = 443
 	GuiProtocol     string = "https"
@@ -100,35 +131,75 @@ const (
 	CertificatePath string = "/var/lib/ibm/ssl/public"
 )
 
-func LoadScaleConfigSettings() ScaleSettingsConfigMap {
-	glog.V(5).Infof("scale_config LoadScaleConfigSettings")
+// ConfigSource provides the Spectrum Scale configuration with secrets and
+// certificates resolved.
+type ConfigSource interface {
+	Load() (ScaleSettingsConfigMap, error)
+	// Watch invokes onChange with the new configuration whenever it changes,
+	// until stop is closed.
+	Watch(onChange func(ScaleSettingsConfigMap), stop <-chan struct{})
+}
+
+// FileConfigSource reads the configuration from a file, and the secrets and
+// certificates mounted below SecretBasePath and CertificatePath.
+type FileConfigSource struct {
+	Path string
+}
+
+func (s FileConfigSource) Load() (ScaleSettingsConfigMap, error) {
+	return LoadScaleConfigSettings(s.Path)
+}
 
-	file, e := ioutil.ReadFile(ConfigMapFile) // TODO
+// Watch does nothing, changes of mounted files require a restart of the driver.
+func (s FileConfigSource) Watch(onChange func(ScaleSettingsConfigMap), stop <-chan struct{}) {
+}
+
+func LoadScaleConfigSettings(configPath string) (ScaleSettingsConfigMap, error) {
+	glog.V(5).Infof("scale_config LoadScaleConfigSettings. path: %s", configPath)
+
+	file, e := ioutil.ReadFile(configPath)
 	if e != nil {
-		glog.Errorf("Spectrum Scale configuration not found: %v", e)
-		return ScaleSettingsConfigMap{}
+		return ScaleSettingsConfigMap{}, fmt.Errorf("Spectrum Scale configuration not found: %v", e)
 	}
-	cmsj := &ScaleSettingsConfigMap{}
-	e = json.Unmarshal(file, cmsj)
+	cmsj, e := ParseScaleConfig(file)
 	if e != nil {
-		glog.Errorf("Error in unmarshalling Spectrum Scale configuration json: %v", e)
-		return ScaleSettingsConfigMap{}
+		return ScaleSettingsConfigMap{}, e
 	}
 
-	e = HandleSecretsAndCerts(cmsj)
+	e = HandleSecretsAndCerts(&cmsj)
 	if e != nil {
-		glog.Errorf("Error in secrets or certificates: %v", e)
-		return ScaleSettingsConfigMap{}
+		return ScaleSettingsConfigMap{}, fmt.Errorf("Error in secrets or certificates: %v", e)
 	}
-	return *cmsj
+	return cmsj, nil
+}
+
+// ParseScaleConfig parses the Spectrum Scale configuration json.
+func ParseScaleConfig(content []byte) (ScaleSettingsConfigMap, error) {
+	cmsj := ScaleSettingsConfigMap{}
+	e := json.Unmarshal(content, &cmsj)
+	if e != nil {
+		return ScaleSettingsConfigMap{}, fmt.Errorf("Error in unmarshalling Spectrum Scale configuration json: %v", e)
+	}
+	return cmsj, nil
 }
 
 func HandleSecretsAndCerts(cmap *ScaleSettingsConfigMap) error {
 	glog.V(5).Infof("scale_config HandleSecrets")
+	readSecret := func(secret string, key string) ([]byte, error) {
+		return ioutil.ReadFile(path.Join(SecretBasePath, secret, key))
+	}
+	readCert := func(cacert string) ([]byte, error) {
+		return ioutil.ReadFile(path.Join(CertificatePath, cacert, cacert))
+	}
+	return resolveSecretsAndCerts(cmap, readSecret, readCert)
+}
+
+// resolveSecretsAndCerts sets the credentials and CA certificates of the
+// clusters, read with readSecret and readCert.
+func resolveSecretsAndCerts(cmap *ScaleSettingsConfigMap, readSecret func(string, string) ([]byte, error), readCert func(string) ([]byte, error)) error {
 	for i := 0; i < len(cmap.Clusters); i++ {
 		if cmap.Clusters[i].Secrets != "" {
-			unamePath := path.Join(SecretBasePath, cmap.Clusters[i].Secrets, "username")
-			file, e := ioutil.ReadFile(unamePath)
+			file, e := readSecret(cmap.Clusters[i].Secrets, "username")
 			if e != nil {
 				return fmt.Errorf("Spectrum Scale secret not found: %v\n", e)
 			}
@@ -136,8 +207,7 @@ func HandleSecretsAndCerts(cmap *ScaleSettingsConfigMap) error {
 			file_s = strings.TrimSpace(file_s)
 			file_s = strings.TrimSuffix(file_s, "\n")
 			cmap.Clusters[i].MgmtUsername = file_s
-			pwdPath := path.Join(SecretBasePath, cmap.Clusters[i].Secrets, "password")
-			file, e = ioutil.ReadFile(pwdPath)
+			file, e = readSecret(cmap.Clusters[i].Secrets, "password")
 			if e != nil {
 				return fmt.Errorf("Spectrum Scale secret not found: %v\n", e)
 			}
@@ -148,9 +218,7 @@ func HandleSecretsAndCerts(cmap *ScaleSettingsConfigMap) error {
 		}
 
 		if cmap.Clusters[i].SecureSslMode && cmap.Clusters[i].Cacert != "" {
-			certPath := path.Join(CertificatePath, cmap.Clusters[i].Cacert)
-			certPath = path.Join(certPath, cmap.Clusters[i].Cacert)
-			file, e := ioutil.ReadFile(certPath)
+			file, e := readCert(cmap.Clusters[i].Cacert)
 			if e != nil {
 				return fmt.Errorf("Spectrum Scale CA certificate not found: %v\n", e)
 			}
@@ -0,0 +1,317 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/connectors"
+	"github.com/IBM/ibm-spectrum-scale-csi-driver/csiplugin/volumeid"
+	"github.com/golang/glog"
+)
+
+// Scheduled snapshots of a fileset are named after the start of their
+// schedule slot, e.g. csi-sched-20191104T100000Z for an hourly schedule.
+// Driver instances running the scheduler concurrently therefore create the
+// same snapshot, and the names sort by creation time.
+//
+// Snapshot IDs are the snapshot name followed by the fields identifying the
+// fileset of the volume, so that they stay within the 128 bytes allowed by CSI:
+//
+//	csi-sched-20191104T100000Z;cid=<cluster_id>;fsuuid=<filesystem_uuid>;fsetid=<fileset_id>
+//
+// Snapshots of volumes of a named primary carry primary=<name>. Snapshots
+// created through CSI are named like group snapshots, e.g.
+// csi-snap-3f2a9c0d41be-20191104T101523Z.
+const (
+	scheduledSnapshotPrefix     = "csi-sched-"
+	volumeSnapshotPrefix        = "csi-snap-"
+	scheduledSnapshotTimeFormat = "20060102T150405Z"
+	snapshotIdSeparator         = ";"
+
+	snapshotIdClusterId = "cid"
+	snapshotIdFsUUID    = "fsuuid"
+	snapshotIdFsetId    = "fsetid"
+	snapshotIdPrimary   = "primary"
+
+	snapshotScheduleMinInterval = 15 * time.Minute
+	snapshotScheduleMaxKeep     = 256
+)
+
+// snapshotSchedule is the interval of scheduled snapshots of a fileset and the
+// number of snapshots kept, written as "<interval>:<keep>", e.g. "1h:24".
+type snapshotSchedule struct {
+	Interval time.Duration
+	Keep     int
+}
+
+func parseSnapshotSchedule(schedule string) (snapshotSchedule, error) {
+	fields := strings.Split(schedule, ":")
+	if len(fields) != 2 {
+		return snapshotSchedule{}, fmt.Errorf("schedule %q must have the form <interval>:<keep>, e.g. \"1h:24\"", schedule)
+	}
+	interval, err := time.ParseDuration(fields[0])
+	if err != nil {
+		return snapshotSchedule{}, fmt.Errorf("invalid interval %q in schedule %q: %v", fields[0], schedule, err)
+	}
+	if interval < snapshotScheduleMinInterval {
+		return snapshotSchedule{}, fmt.Errorf("interval %q in schedule %q must be at least %v", fields[0], schedule, snapshotScheduleMinInterval)
+	}
+	keep, err := strconv.Atoi(fields[1])
+	if err != nil || keep < 1 || keep > snapshotScheduleMaxKeep {
+		return snapshotSchedule{}, fmt.Errorf("number of snapshots kept %q in schedule %q must be between 1 and %d", fields[1], schedule, snapshotScheduleMaxKeep)
+	}
+	return snapshotSchedule{Interval: interval, Keep: keep}, nil
+}
+
+// scheduledSnapshotName returns the name of the snapshot of the slot of now.
+func (s snapshotSchedule) scheduledSnapshotName(now time.Time) string {
+	return scheduledSnapshotPrefix + now.UTC().Truncate(s.Interval).Format(scheduledSnapshotTimeFormat)
+}
+
+// parseScheduledSnapshotName returns the slot time of a scheduled snapshot,
+// and false for snapshots not created by the scheduler.
+func parseScheduledSnapshotName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, scheduledSnapshotPrefix) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(scheduledSnapshotTimeFormat, strings.TrimPrefix(name, scheduledSnapshotPrefix))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// getScheduledSnapshots returns the names of the scheduled snapshots in
+// snapshots, oldest first.
+func getScheduledSnapshots(snapshots []connectors.Snapshot_v2) []string {
+	names := []string{}
+	for _, snapshot := range snapshots {
+		if _, ok := parseScheduledSnapshotName(snapshot.SnapshotName); ok {
+			names = append(names, snapshot.SnapshotName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// volumeSnapshotNamePrefix returns the prefix of the names of the snapshots
+// created for the CSI snapshot name.
+func volumeSnapshotNamePrefix(name string) string {
+	return hashedSnapshotNamePrefix(volumeSnapshotPrefix, name)
+}
+
+// parseVolumeSnapshotName returns the creation time of a snapshot created
+// through CSI, and false for other snapshots.
+func parseVolumeSnapshotName(name string) (time.Time, bool) {
+	return parseHashedSnapshotName(volumeSnapshotPrefix, name)
+}
+
+// parseSnapshotName returns the creation time of a scheduled, volume or group
+// snapshot, and false for snapshots not created by the driver.
+func parseSnapshotName(name string) (time.Time, bool) {
+	if t, ok := parseScheduledSnapshotName(name); ok {
+		return t, true
+	}
+	if t, ok := parseVolumeSnapshotName(name); ok {
+		return t, true
+	}
+	return parseGroupSnapshotName(name)
+}
+
+// getDriverSnapshots returns the names of the scheduled, volume and group
+// snapshots in snapshots, sorted by name.
+func getDriverSnapshots(snapshots []connectors.Snapshot_v2) []string {
+	names := []string{}
+	for _, snapshot := range snapshots {
+		if _, ok := parseSnapshotName(snapshot.SnapshotName); ok {
+			names = append(names, snapshot.SnapshotName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func encodeSnapshotId(snapshotName string, volumeIdMembers volumeid.VolumeID) string {
+	fields := []string{
+		snapshotName,
+		snapshotIdClusterId + "=" + volumeIdMembers.ClusterId,
+		snapshotIdFsUUID + "=" + volumeIdMembers.FsUUID,
+		snapshotIdFsetId + "=" + volumeIdMembers.FsetId,
+	}
+	if volumeIdMembers.PrimaryName != "" {
+		fields = append(fields, snapshotIdPrimary+"="+volumeIdMembers.PrimaryName)
+	}
+	return strings.Join(fields, snapshotIdSeparator)
+}
+
+// decodeSnapshotId returns the snapshot name of a snapshot ID and the fields
+// of the volume ID identifying the fileset of the snapshot.
+func decodeSnapshotId(snapshotId string) (string, volumeid.VolumeID, error) {
+	fields := strings.Split(snapshotId, snapshotIdSeparator)
+	if _, ok := parseSnapshotName(fields[0]); !ok {
+		return "", volumeid.VolumeID{}, fmt.Errorf("snapshot ID %q does not reference a snapshot of the driver", snapshotId)
+	}
+
+	v := volumeid.VolumeID{Version: volumeid.Version2, VolType: volumeid.TypeFileset}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return "", volumeid.VolumeID{}, fmt.Errorf("invalid field %q in snapshot ID %q", field, snapshotId)
+		}
+		switch kv[0] {
+		case snapshotIdClusterId:
+			v.ClusterId = kv[1]
+		case snapshotIdFsUUID:
+			v.FsUUID = kv[1]
+		case snapshotIdFsetId:
+			v.FsetId = kv[1]
+		case snapshotIdPrimary:
+			v.PrimaryName = kv[1]
+		}
+	}
+	if v.ClusterId == "" || v.FsUUID == "" || v.FsetId == "" {
+		return "", volumeid.VolumeID{}, fmt.Errorf("cluster ID, filesystem UUID or fileset ID missing in snapshot ID %q", snapshotId)
+	}
+	return fields[0], v, nil
+}
+
+// isSnapshotOfVolume returns true if the fileset identified by a snapshot ID
+// is the fileset of a volume.
+func isSnapshotOfVolume(snapshotVolume volumeid.VolumeID, volumeIdMembers volumeid.VolumeID) bool {
+	return volumeIdMembers.IsFilesetBased() &&
+		snapshotVolume.ClusterId == volumeIdMembers.ClusterId &&
+		snapshotVolume.FsUUID == volumeIdMembers.FsUUID &&
+		snapshotVolume.FsetId == volumeIdMembers.FsetId &&
+		snapshotVolume.PrimaryName == volumeIdMembers.PrimaryName
+}
+
+// RunSnapshotScheduler creates and prunes scheduled snapshots of the filesets
+// of all clusters every interval until stop is closed.
+func (cs *ScaleControllerServer) RunSnapshotScheduler(interval time.Duration, stop <-chan struct{}) {
+	glog.Infof("Starting snapshot scheduler with interval %v", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cs.RunScheduledSnapshots(time.Now())
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// RunScheduledSnapshots snapshots all filesets created by the driver with a
+// snapshot schedule in their fileset comment.
+func (cs *ScaleControllerServer) RunScheduledSnapshots(now time.Time) {
+	for clusterId, conn := range cs.Driver.connmap {
+		filesystems, err := conn.ListFilesystems()
+		if err != nil {
+			glog.Errorf("Unable to list filesystems of cluster %s for scheduled snapshots: %v", clusterId, err)
+			continue
+		}
+
+		for _, fsName := range filesystems {
+			filesets, err := conn.ListFilesets(fsName)
+			if err != nil {
+				/* Filesets of remotely mounted filesystems are listed by their owning cluster */
+				glog.V(4).Infof("Unable to list filesets of FS %s in cluster %s: %v", fsName, clusterId, err)
+				continue
+			}
+
+			for _, fileset := range filesets {
+				comment, err := parseFilesetComment(fileset.Config.Comment)
+				if err != nil || comment.Driver != cs.Driver.name || comment.Schedule == "" {
+					continue
+				}
+				schedule, err := parseSnapshotSchedule(comment.Schedule)
+				if err != nil {
+					glog.Errorf("Invalid snapshot schedule of fileset %s in FS %s: %v", fileset.FilesetName, fsName, err)
+					continue
+				}
+				err = cs.SnapshotFileset(conn, fsName, fileset.FilesetName, schedule, now)
+				if err != nil {
+					glog.Errorf("Scheduled snapshot of fileset %s in FS %s failed: %v", fileset.FilesetName, fsName, err)
+				}
+			}
+		}
+	}
+}
+
+// SnapshotFileset creates the snapshot of the current slot of schedule,
+// unless it exists, and deletes the oldest scheduled snapshots exceeding the
+// number of snapshots kept.
+func (cs *ScaleControllerServer) SnapshotFileset(conn connectors.SpectrumScaleConnector, fsName string, filesetName string, schedule snapshotSchedule, now time.Time) error {
+	snapshots, err := conn.ListFilesetSnapshots(fsName, filesetName)
+	if err != nil {
+		return err
+	}
+	names := getScheduledSnapshots(snapshots)
+
+	name := schedule.scheduledSnapshotName(now)
+	idx := sort.SearchStrings(names, name)
+	if idx == len(names) || names[idx] != name {
+		err = conn.CreateFilesetSnapshot(fsName, filesetName, name)
+		if err != nil {
+			/* Another driver instance may have created the snapshot */
+			snapshots, listErr := conn.ListFilesetSnapshots(fsName, filesetName)
+			if listErr != nil {
+				return err
+			}
+			names = getScheduledSnapshots(snapshots)
+			idx = sort.SearchStrings(names, name)
+			if idx == len(names) || names[idx] != name {
+				return err
+			}
+		} else {
+			glog.Infof("Created scheduled snapshot %s of fileset %s in FS %s", name, filesetName, fsName)
+			names = append(names[:idx], append([]string{name}, names[idx:]...)...)
+		}
+	}
+
+	for len(names) > schedule.Keep {
+		err = conn.DeleteFilesetSnapshot(fsName, filesetName, names[0])
+		if err != nil {
+			return err
+		}
+		glog.Infof("Deleted scheduled snapshot %s of fileset %s in FS %s", names[0], filesetName, fsName)
+		names = names[1:]
+	}
+	return nil
+}
+
+// DeleteScheduledSnapshots deletes all scheduled snapshots of a fileset, a
+// fileset with snapshots can not be deleted.
+func (cs *ScaleControllerServer) DeleteScheduledSnapshots(conn connectors.SpectrumScaleConnector, fsName string, filesetName string) error {
+	snapshots, err := conn.ListFilesetSnapshots(fsName, filesetName)
+	if err != nil {
+		return err
+	}
+	for _, name := range getScheduledSnapshots(snapshots) {
+		err = conn.DeleteFilesetSnapshot(fsName, filesetName, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
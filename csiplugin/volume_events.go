@@ -0,0 +1,73 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scale
+
+import (
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// VolumeEventRecorder records events of persistent volumes.
+type VolumeEventRecorder interface {
+	// Event records an event of type corev1.EventTypeNormal or
+	// corev1.EventTypeWarning for persistent volume pvName.
+	Event(pvName string, eventType string, reason string, message string)
+}
+
+// logEventRecorder only logs events, it is used without access to the
+// Kubernetes API.
+type logEventRecorder struct{}
+
+func (logEventRecorder) Event(pvName string, eventType string, reason string, message string) {
+	if eventType == corev1.EventTypeWarning {
+		glog.Warningf("PV %s: %s: %s", pvName, reason, message)
+		return
+	}
+	glog.Infof("PV %s: %s: %s", pvName, reason, message)
+}
+
+// kubeEventRecorder records events on the persistent volume objects, and logs
+// them.
+type kubeEventRecorder struct {
+	client   kubernetes.Interface
+	recorder record.EventRecorder
+}
+
+// NewKubeEventRecorder returns a recorder creating events of component in the
+// Kubernetes API.
+func NewKubeEventRecorder(client kubernetes.Interface, component string) VolumeEventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component})
+	return &kubeEventRecorder{client: client, recorder: recorder}
+}
+
+func (r *kubeEventRecorder) Event(pvName string, eventType string, reason string, message string) {
+	logEventRecorder{}.Event(pvName, eventType, reason, message)
+
+	pv, err := r.client.CoreV1().PersistentVolumes().Get(pvName, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Unable to record event %s of PV %s: %v", reason, pvName, err)
+		return
+	}
+	r.recorder.Event(pv, eventType, reason, message)
+}
@@ -0,0 +1,290 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package volumeid encodes and decodes the IDs of volumes created by the driver.
+//
+// Version 1 IDs have positional fields and are told apart by their number:
+//
+//	<cluster_id>;<filesystem_uuid>;path=<symlink_path>
+//	<cluster_id>;<filesystem_uuid>;fileset=<fileset_id>;path=<symlink_path>
+//
+// Version 2 IDs start with a version prefix followed by key=value fields. The
+// path is always the last field, so that it may contain any character. Fields
+// which can be derived are left out to keep IDs short, CSI limits them to 128
+// bytes. Volumes with a fileset ID are fileset based, the others directories:
+//
+//	v2;cid=<cluster_id>;fsuuid=<filesystem_uuid>;fsetid=<fileset_id>;path=<symlink_path>
+//
+// Volumes created in direct path mode carry mode=direct and the filesystem
+// name, their path is the data path of the volume instead of a symlink in the
+// primary fileset:
+//
+//	v2;cid=<cluster_id>;fsuuid=<filesystem_uuid>;fs=<filesystem>;mode=direct;path=<data_path>
+//
+// Volumes of a named primary carry primary=<name>, volumes without it belong
+// to the default primary. Volumes exported through CES NFS carry nfs=1, the
+// path of the export is derived from the data path of the volume.
+//
+// IDs written by earlier driver versions may carry type=<fileset|dir>,
+// fset=<fileset_name>, fs=<filesystem> in symlink mode and
+// nfs=<export_path>, which are still decoded.
+package volumeid
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	Version1 = 1
+	Version2 = 2
+
+	TypeFileset   = "fileset"
+	TypeDirectory = "dir"
+
+	PathModeSymlink = "symlink"
+	PathModeDirect  = "direct"
+
+	version2Prefix = "v2"
+	separator      = ";"
+
+	keyClusterId = "cid"
+	keyFsUUID    = "fsuuid"
+	keyFsName    = "fs"
+	keyType      = "type"
+	keyFsetId    = "fsetid"
+	keyFsetName  = "fset"
+	keyPathMode  = "mode"
+	keyPrimary   = "primary"
+	keyNfsExport = "nfs"
+	nfsExported  = "1"
+	keyPath      = "path"
+
+	legacyKeyFileset = "fileset"
+)
+
+// VolumeID holds the fields of a volume ID. FsName is only available in
+// version 2 IDs of direct path volumes, FsetName and NfsExportPath only in IDs
+// of earlier driver versions. SymLnkPath is the data path of the volume if
+// PathMode is PathModeDirect.
+type VolumeID struct {
+	Version       int
+	ClusterId     string
+	FsUUID        string
+	FsName        string
+	VolType       string
+	FsetId        string
+	FsetName      string
+	PathMode      string
+	PrimaryName   string
+	NfsExport     bool
+	NfsExportPath string
+	SymLnkPath    string
+}
+
+// IsFilesetBased returns true for volumes backed by a fileset.
+func (v VolumeID) IsFilesetBased() bool {
+	return v.VolType == TypeFileset
+}
+
+// IsDirectPath returns true for volumes which do not use a symlink in the
+// primary fileset.
+func (v VolumeID) IsDirectPath() bool {
+	return v.PathMode == PathModeDirect
+}
+
+// Encode returns the version 2 ID of a volume.
+func Encode(v VolumeID) (string, error) {
+	if v.ClusterId == "" || v.FsUUID == "" || v.SymLnkPath == "" {
+		return "", fmt.Errorf("cluster ID, filesystem UUID and path are required in volume ID")
+	}
+
+	fields := []string{version2Prefix}
+	add := func(key string, value string) error {
+		if strings.Contains(value, separator) {
+			return fmt.Errorf("value %q of %s must not contain %q", value, key, separator)
+		}
+		if value != "" {
+			fields = append(fields, key+"="+value)
+		}
+		return nil
+	}
+
+	switch v.VolType {
+	case TypeDirectory:
+	case TypeFileset:
+		if v.FsetId == "" {
+			return "", fmt.Errorf("fileset ID is required in volume ID of fileset based volume")
+		}
+	default:
+		return "", fmt.Errorf("invalid volume type %q", v.VolType)
+	}
+
+	pathMode := ""
+	switch v.PathMode {
+	case "", PathModeSymlink:
+	case PathModeDirect:
+		if v.FsName == "" {
+			return "", fmt.Errorf("filesystem name is required in volume ID of direct path volume")
+		}
+		pathMode = PathModeDirect
+	default:
+		return "", fmt.Errorf("invalid path mode %q", v.PathMode)
+	}
+
+	/* The type is implied by the fileset ID, the filesystem name is only
+	   needed to resolve the data path of direct path volumes */
+	fsName := ""
+	if pathMode == PathModeDirect {
+		fsName = v.FsName
+	}
+	fsetId := ""
+	if v.VolType == TypeFileset {
+		fsetId = v.FsetId
+	}
+	nfs := ""
+	if v.NfsExport {
+		nfs = nfsExported
+	}
+	for _, kv := range [][2]string{
+		{keyClusterId, v.ClusterId},
+		{keyFsUUID, v.FsUUID},
+		{keyFsName, fsName},
+		{keyFsetId, fsetId},
+		{keyPathMode, pathMode},
+		{keyPrimary, v.PrimaryName},
+		{keyNfsExport, nfs},
+	} {
+		if err := add(kv[0], kv[1]); err != nil {
+			return "", err
+		}
+	}
+	fields = append(fields, keyPath+"="+v.SymLnkPath)
+	return strings.Join(fields, separator), nil
+}
+
+// Decode parses a version 1 or version 2 volume ID.
+func Decode(id string) (VolumeID, error) {
+	if strings.HasPrefix(id, version2Prefix+separator) {
+		return decodeV2(strings.TrimPrefix(id, version2Prefix+separator))
+	}
+	return decodeV1(id)
+}
+
+func decodeV2(fields string) (VolumeID, error) {
+	v := VolumeID{Version: Version2, PathMode: PathModeSymlink}
+	for fields != "" {
+		var field string
+		if strings.HasPrefix(fields, keyPath+"=") {
+			/* path is the last field and may contain the separator */
+			field, fields = fields, ""
+		} else {
+			i := strings.Index(fields, separator)
+			if i < 0 {
+				field, fields = fields, ""
+			} else {
+				field, fields = fields[:i], fields[i+1:]
+			}
+		}
+
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return VolumeID{}, fmt.Errorf("invalid field %q in volume ID", field)
+		}
+		switch kv[0] {
+		case keyClusterId:
+			v.ClusterId = kv[1]
+		case keyFsUUID:
+			v.FsUUID = kv[1]
+		case keyFsName:
+			v.FsName = kv[1]
+		case keyType:
+			v.VolType = kv[1]
+		case keyFsetId:
+			v.FsetId = kv[1]
+		case keyFsetName:
+			v.FsetName = kv[1]
+		case keyPathMode:
+			v.PathMode = kv[1]
+		case keyPrimary:
+			v.PrimaryName = kv[1]
+		case keyNfsExport:
+			v.NfsExport = kv[1] != ""
+			if kv[1] != nfsExported {
+				v.NfsExportPath = kv[1]
+			}
+		case keyPath:
+			v.SymLnkPath = kv[1]
+		}
+		/* Unknown fields are ignored, they may be added by later versions */
+	}
+
+	if v.ClusterId == "" || v.FsUUID == "" || v.SymLnkPath == "" {
+		return VolumeID{}, fmt.Errorf("cluster ID, filesystem UUID or path missing in volume ID")
+	}
+	if v.VolType == "" {
+		v.VolType = TypeDirectory
+		if v.FsetId != "" {
+			v.VolType = TypeFileset
+		}
+	}
+	if v.VolType != TypeFileset && v.VolType != TypeDirectory {
+		return VolumeID{}, fmt.Errorf("invalid volume type %q in volume ID", v.VolType)
+	}
+	if v.IsFilesetBased() && v.FsetId == "" {
+		return VolumeID{}, fmt.Errorf("fileset ID missing in volume ID of fileset based volume")
+	}
+	if v.PathMode != PathModeSymlink && v.PathMode != PathModeDirect {
+		return VolumeID{}, fmt.Errorf("invalid path mode %q in volume ID", v.PathMode)
+	}
+	if v.IsDirectPath() && v.FsName == "" {
+		return VolumeID{}, fmt.Errorf("filesystem name missing in volume ID of direct path volume")
+	}
+	return v, nil
+}
+
+func decodeV1(id string) (VolumeID, error) {
+	fields := strings.Split(id, separator)
+	v := VolumeID{Version: Version1, PathMode: PathModeSymlink}
+
+	var pathField string
+	switch len(fields) {
+	case 3:
+		/* <cluster_id>;<filesystem_uuid>;path=<symlink_path> */
+		v.VolType = TypeDirectory
+		pathField = fields[2]
+	case 4:
+		/* <cluster_id>;<filesystem_uuid>;fileset=<fileset_id>;path=<symlink_path> */
+		v.VolType = TypeFileset
+		fsetSplit := strings.SplitN(fields[2], "=", 2)
+		if len(fsetSplit) < 2 || strings.TrimSpace(fsetSplit[0]) != legacyKeyFileset || fsetSplit[1] == "" {
+			return VolumeID{}, fmt.Errorf("invalid fileset field %q in volume ID", fields[2])
+		}
+		v.FsetId = fsetSplit[1]
+		pathField = fields[3]
+	default:
+		return VolumeID{}, fmt.Errorf("invalid number of fields in volume ID %q", id)
+	}
+
+	pathSplit := strings.SplitN(pathField, "=", 2)
+	if len(pathSplit) < 2 || strings.TrimSpace(pathSplit[0]) != keyPath || pathSplit[1] == "" {
+		return VolumeID{}, fmt.Errorf("invalid path field %q in volume ID", pathField)
+	}
+	v.SymLnkPath = pathSplit[1]
+	v.ClusterId = fields[0]
+	v.FsUUID = fields[1]
+	return v, nil
+}
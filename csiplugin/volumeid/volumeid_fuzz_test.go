@@ -0,0 +1,62 @@
+//go:build go1.18
+// +build go1.18
+
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package volumeid
+
+import (
+	"reflect"
+	"testing"
+)
+
+// FuzzDecode checks that Decode does not panic and that every decoded version
+// 2 ID is encoded to an ID decoding to the same fields.
+func FuzzDecode(f *testing.F) {
+	f.Add(testClusterId + ";" + testFsUUID + ";path=" + testSymlink)
+	f.Add(testClusterId + ";" + testFsUUID + ";fileset=" + testFsetId + "; path=" + testSymlink)
+	f.Add("v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID + ";fsetid=" + testFsetId + ";primary=gold;path=" + testSymlink)
+	f.Add("v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID + ";fs=fs1;type=dir;mode=direct;nfs=1;path=" + testDataPath)
+
+	f.Fuzz(func(t *testing.T, id string) {
+		v, err := Decode(id)
+		if err != nil || v.Version != Version2 {
+			return
+		}
+		encoded, err := Encode(v)
+		if err != nil {
+			/* Fields of IDs of earlier versions may not be encodable */
+			return
+		}
+		again, err := Decode(encoded)
+		if err != nil {
+			t.Fatalf("Decode(%q) of Encode(%+v) failed: %v", encoded, v, err)
+		}
+		want := v
+		want.FsetName = ""
+		want.NfsExportPath = ""
+		if !want.IsDirectPath() {
+			want.FsName = ""
+		}
+		if !want.IsFilesetBased() {
+			want.FsetId = ""
+		}
+		if !reflect.DeepEqual(again, want) {
+			t.Fatalf("Decode(%q) = %+v, want %+v", encoded, again, want)
+		}
+	})
+}
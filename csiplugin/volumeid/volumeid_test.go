@@ -0,0 +1,210 @@
+/**
+ * Copyright 2019 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package volumeid
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	testClusterId = "7118073361626808055"
+	testFsUUID    = "0A3C5F2B:5DA7F1C4"
+	testFsetId    = "12"
+	testSymlink   = "/ibm/gpfs0/primary-fileset/.volumes/pvc-8a3e0c5e-0d3f-4c7b-9a51-2d1c4f9b7e21"
+	testDataPath  = "/ibm/fs1/pvc-8a3e0c5e-0d3f-4c7b-9a51-2d1c4f9b7e21/pvc-8a3e0c5e-0d3f-4c7b-9a51-2d1c4f9b7e21-data"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		id   VolumeID
+	}{
+		{
+			name: "directory symlink",
+			id:   VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeDirectory, PathMode: PathModeSymlink, SymLnkPath: testSymlink},
+		},
+		{
+			name: "fileset symlink",
+			id:   VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeFileset, FsetId: testFsetId, PathMode: PathModeSymlink, SymLnkPath: testSymlink},
+		},
+		{
+			name: "directory direct",
+			id:   VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, FsName: "fs1", VolType: TypeDirectory, PathMode: PathModeDirect, SymLnkPath: testDataPath},
+		},
+		{
+			name: "fileset direct",
+			id:   VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, FsName: "fs1", VolType: TypeFileset, FsetId: testFsetId, PathMode: PathModeDirect, SymLnkPath: testDataPath},
+		},
+		{
+			name: "fileset symlink with primary and nfs",
+			id:   VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeFileset, FsetId: testFsetId, PathMode: PathModeSymlink, PrimaryName: "gold", NfsExport: true, SymLnkPath: testSymlink},
+		},
+		{
+			name: "directory direct with primary and nfs",
+			id:   VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, FsName: "fs1", VolType: TypeDirectory, PathMode: PathModeDirect, PrimaryName: "gold", NfsExport: true, SymLnkPath: testDataPath},
+		},
+		{
+			name: "path with separator",
+			id:   VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeDirectory, PathMode: PathModeSymlink, SymLnkPath: "/ibm/gpfs0/a;b=c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := Encode(tt.id)
+			if err != nil {
+				t.Fatalf("Encode(%+v) failed: %v", tt.id, err)
+			}
+			decoded, err := Decode(encoded)
+			if err != nil {
+				t.Fatalf("Decode(%q) failed: %v", encoded, err)
+			}
+			want := tt.id
+			want.Version = Version2
+			if reflect.DeepEqual(decoded, want) {
+				return
+			}
+			t.Errorf("Decode(%q) = %+v, want %+v", encoded, decoded, want)
+		})
+	}
+}
+
+func TestEncodeLeavesOutDerivableFields(t *testing.T) {
+	id := VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, FsName: "gpfs0", VolType: TypeFileset, FsetId: testFsetId, FsetName: "pvc-8a3e0c5e", SymLnkPath: testSymlink}
+	encoded, err := Encode(id)
+	if err != nil {
+		t.Fatalf("Encode(%+v) failed: %v", id, err)
+	}
+	want := "v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID + ";fsetid=" + testFsetId + ";path=" + testSymlink
+	if encoded != want {
+		t.Errorf("Encode(%+v) = %q, want %q", id, encoded, want)
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		id   VolumeID
+	}{
+		{name: "missing cluster ID", id: VolumeID{FsUUID: testFsUUID, VolType: TypeDirectory, SymLnkPath: testSymlink}},
+		{name: "missing path", id: VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeDirectory}},
+		{name: "invalid type", id: VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, VolType: "block", SymLnkPath: testSymlink}},
+		{name: "fileset without ID", id: VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeFileset, SymLnkPath: testSymlink}},
+		{name: "direct without filesystem", id: VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeDirectory, PathMode: PathModeDirect, SymLnkPath: testDataPath}},
+		{name: "separator in value", id: VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeDirectory, PrimaryName: "a;b", SymLnkPath: testSymlink}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if encoded, err := Encode(tt.id); err == nil {
+				t.Errorf("Encode(%+v) = %q, want error", tt.id, encoded)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want VolumeID
+	}{
+		{
+			name: "version 1 directory",
+			id:   testClusterId + ";" + testFsUUID + ";path=" + testSymlink,
+			want: VolumeID{Version: Version1, ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeDirectory, PathMode: PathModeSymlink, SymLnkPath: testSymlink},
+		},
+		{
+			name: "version 1 fileset",
+			id:   testClusterId + ";" + testFsUUID + ";fileset=" + testFsetId + ";path=" + testSymlink,
+			want: VolumeID{Version: Version1, ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeFileset, FsetId: testFsetId, PathMode: PathModeSymlink, SymLnkPath: testSymlink},
+		},
+		{
+			name: "version 1 fileset with space before path",
+			id:   testClusterId + ";" + testFsUUID + ";fileset=" + testFsetId + "; path=" + testSymlink,
+			want: VolumeID{Version: Version1, ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeFileset, FsetId: testFsetId, PathMode: PathModeSymlink, SymLnkPath: testSymlink},
+		},
+		{
+			name: "version 1 directory with space before path",
+			id:   testClusterId + ";" + testFsUUID + "; path=" + testSymlink,
+			want: VolumeID{Version: Version1, ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeDirectory, PathMode: PathModeSymlink, SymLnkPath: testSymlink},
+		},
+		{
+			name: "version 2 of earlier driver versions",
+			id:   "v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID + ";fs=gpfs0;type=fileset;fsetid=" + testFsetId + ";fset=pvc-1;path=" + testSymlink,
+			want: VolumeID{Version: Version2, ClusterId: testClusterId, FsUUID: testFsUUID, FsName: "gpfs0", VolType: TypeFileset, FsetId: testFsetId, FsetName: "pvc-1", PathMode: PathModeSymlink, SymLnkPath: testSymlink},
+		},
+		{
+			name: "version 2 with nfs export path",
+			id:   "v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID + ";fsetid=" + testFsetId + ";nfs=/ibm/fs1/pvc-1/pvc-1-data;path=" + testSymlink,
+			want: VolumeID{Version: Version2, ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeFileset, FsetId: testFsetId, PathMode: PathModeSymlink, NfsExport: true, NfsExportPath: "/ibm/fs1/pvc-1/pvc-1-data", SymLnkPath: testSymlink},
+		},
+		{
+			name: "version 2 with unknown field",
+			id:   "v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID + ";new=1;path=" + testSymlink,
+			want: VolumeID{Version: Version2, ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeDirectory, PathMode: PathModeSymlink, SymLnkPath: testSymlink},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.id)
+			if err != nil {
+				t.Fatalf("Decode(%q) failed: %v", tt.id, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode(%q) = %+v, want %+v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, id := range []string{
+		"",
+		testClusterId,
+		testClusterId + ";" + testFsUUID,
+		testClusterId + ";" + testFsUUID + ";" + testSymlink,
+		testClusterId + ";" + testFsUUID + ";path=",
+		testClusterId + ";" + testFsUUID + ";fset=" + testFsetId + ";path=" + testSymlink,
+		testClusterId + ";" + testFsUUID + ";fileset=;path=" + testSymlink,
+		"v2;cid=" + testClusterId + ";path=" + testSymlink,
+		"v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID,
+		"v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID + ";type=fileset;path=" + testSymlink,
+		"v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID + ";type=block;path=" + testSymlink,
+		"v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID + ";mode=direct;path=" + testDataPath,
+		"v2;cid=" + testClusterId + ";fsuuid=" + testFsUUID + ";mode=hard;path=" + testSymlink,
+		"v2;cid=" + testClusterId + ";fsuuid;path=" + testSymlink,
+	} {
+		if got, err := Decode(id); err == nil {
+			t.Errorf("Decode(%q) = %+v, want error", id, got)
+		}
+	}
+}
+
+func TestEncodedLength(t *testing.T) {
+	/* CSI limits volume IDs to 128 bytes */
+	id := VolumeID{ClusterId: testClusterId, FsUUID: testFsUUID, VolType: TypeFileset, FsetId: testFsetId, SymLnkPath: "/ibm/gpfs0/csi/pvc-8a3e0c5e-0d3f-4c7b-9a51-2d1c4f9b7e21"}
+	encoded, err := Encode(id)
+	if err != nil {
+		t.Fatalf("Encode(%+v) failed: %v", id, err)
+	}
+	if len(encoded) > 128 {
+		t.Errorf("Encode(%+v) = %q has %d bytes, want at most 128", id, encoded, len(encoded))
+	}
+}
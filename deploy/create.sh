@@ -6,6 +6,9 @@ kubectl apply -f deploy/csi-provisioner-rbac.yaml
 
 kubectl apply -f deploy/spectrum-scale-secret.json
 kubectl create configmap spectrum-scale-config --from-file=spectrum-scale-config.json=deploy/spectrum-scale-config.json
+if [ -f deploy/spectrum-scale-node-mapping.json ]; then
+  kubectl create configmap spectrum-scale-node-mapping --from-file=node-mapping.json=deploy/spectrum-scale-node-mapping.json
+fi
 
 kubectl apply -f deploy/csi-plugin-attacher.yaml
 kubectl apply -f deploy/csi-plugin-provisioner.yaml
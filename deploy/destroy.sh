@@ -6,6 +6,7 @@ kubectl delete -f deploy/csi-provisioner-rbac.yaml
 
 kubectl delete -f deploy/spectrum-scale-secret.json
 kubectl delete configmap spectrum-scale-config 
+kubectl delete configmap spectrum-scale-node-mapping --ignore-not-found
 
 kubectl delete -f deploy/csi-plugin-attacher.yaml
 kubectl delete -f deploy/csi-plugin-provisioner.yaml
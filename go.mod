@@ -3,9 +3,12 @@ module github.com/IBM/ibm-spectrum-scale-csi-driver
 go 1.13
 
 require (
-	github.com/container-storage-interface/spec v1.1.0
+	github.com/container-storage-interface/spec v1.8.0
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
-	golang.org/x/net v0.0.0-20191028085509-fe3aa8a45271
-	google.golang.org/genproto v0.0.0-20190502173448-54afdca5d873 // indirect
-	google.golang.org/grpc v1.24.0
+	github.com/golang/protobuf v1.3.2
+	golang.org/x/net v0.7.0
+	google.golang.org/grpc v1.26.0
+	k8s.io/api v0.17.5
+	k8s.io/apimachinery v0.17.5
+	k8s.io/client-go v0.17.5
 )
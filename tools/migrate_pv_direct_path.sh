@@ -0,0 +1,305 @@
+#!/bin/bash
+#
+# Copyright 2019 IBM Corp.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+usage(){
+echo "Usage: $0
+                -v|--volumehandle <volumeHandle of the existing pv>
+                -f|--filesystem <Name of Volume's Source Filesystem>
+                -p|--pvname <name of the existing pv>
+                -s|--size <size in GB>
+                -n|--pvc <namespace/name of the pvc bound to the pv>
+                [-c|--storageclass <StorageClass for pv>]
+                [-a|--accessmode <AccessMode for pv>]
+                [-h|--help] " 1>&2; exit 1; }
+
+fullUsage(){
+echo "Usage: $0
+		-v|--volumehandle <volumeHandle of the existing pv>
+		-f|--filesystem <Name of Volume's Source Filesystem>
+		-p|--pvname <name of the existing pv>
+		-s|--size <size in GB>
+		-n|--pvc <namespace/name of the pvc bound to the pv>
+		[-c|--storageclass <StorageClass for pv>]
+		[-a|--accessmode <AccessMode for pv>]
+		[-h|--help]
+
+
+Migrates a volume created with volumePathMode=symlink to volumePathMode=direct. The symlink
+of the volume in the primary fileset is resolved and a pv yaml is generated whose volumeHandle
+references the data path of the volume directly.
+
+Example:
+	The pv 'pvc-29fa4d32' bound to pvc 'default/data' is a fileset based volume from filesystem gpfs1.
+
+	$0 --volumehandle \"\$(kubectl get pv pvc-29fa4d32 -o jsonpath='{.spec.csi.volumeHandle}')\" \\
+		--filesystem gpfs1 --pvname pvc-29fa4d32 --size 10 --pvc default/data
+
+	The volumeHandle of a pv can not be changed, so the pv has to be recreated:
+
+	1. Stop all pods using the pvc.
+	2. kubectl patch pv pvc-29fa4d32 -p '{\"spec\":{\"persistentVolumeReclaimPolicy\":\"Retain\"}}'
+	3. kubectl delete pv pvc-29fa4d32
+	   The pvc becomes Lost until the pv is recreated.
+	4. kubectl create -f pvc-29fa4d32.yaml
+	   The generated pv is prebound to the pvc, the pvc becomes Bound again.
+	5. Once the volume is verified, the symlink printed by this script can be removed from the
+	   primary fileset.
+
+	Note: This script must be run on a Spectrum Scale node of the primary cluster where the
+	      primary filesystem and the volume filesystem are mounted." 1>&2; exit 1; }
+
+# Generate Yaml
+generate_yaml()
+{
+volhandle=$1
+volname=$2
+volsize=$3
+accessmode=$4
+pvcnamespace=$5
+pvcname=$6
+if [[ -f "${volname}.yaml" ]]; then
+    echo "ERROR: File ${volname}.yaml already exist"
+    exit 2
+fi
+
+cat > ${volname}.yaml  <<EOL
+# -- ${volname}.yaml
+apiVersion: v1
+kind: PersistentVolume
+metadata:
+        name: ${volname}
+spec:
+  capacity:
+    storage: ${volsize}Gi
+  accessModes:
+    - ${accessmode}
+  persistentVolumeReclaimPolicy: Delete
+  claimRef:
+    namespace: ${pvcnamespace}
+    name: ${pvcname}
+  csi:
+    driver: spectrumscale.csi.ibm.com
+    volumeHandle: ${volhandle}
+  ${STORAGECLASS}
+EOL
+echo "INFO: volumeHandle: ${volhandle}"
+echo "INFO: Successfully created ${volname}.yaml"
+}
+
+
+SHORT=hv:f:p:s:n:c:a:
+LONG=help,volumehandle:,filesystem:,pvname:,size:,pvc:,storageclass:,accessmode:
+ERROROUT="/tmp/csierror.out"
+OPTS=$(getopt --options $SHORT --long $LONG --name "$0" -- "$@")
+
+if [ $? != 0 ]; then echo "Failed to parse options...exiting." >&2; usage ; exit 1 ; fi
+[[ $# -lt 1 ]] && fullUsage
+
+eval set -- "$OPTS"
+
+while true ; do
+  case "$1" in
+    -h | --help )
+      fullUsage
+      ;;
+    -v | --volumehandle )
+      VOLHANDLE="$2"
+      shift 2
+      ;;
+    -f | --filesystem )
+      FSNAME="$2"
+      shift 2
+      ;;
+    -p | --pvname )
+      VOLNAME="$2"
+      shift 2
+      ;;
+    -s | --size )
+      VOLSIZE="$2"
+      shift 2
+      ;;
+    -n | --pvc )
+      PVC="$2"
+      shift 2
+      ;;
+    -c | --storageclass )
+      CLASS="$2"
+      shift 2
+      ;;
+    -a | --accessmode )
+      ACCESSMODE="$2"
+      shift 2
+      ;;
+    -- )
+      shift
+      break
+      ;;
+    *)
+      usage
+      exit 1
+      ;;
+  esac
+done
+
+
+# Check for mandatory Params
+MPARAM=""
+[[ -z "${VOLHANDLE}" ]] && MPARAM="${MPARAM}--volumehandle "
+[[ -z "${FSNAME}" ]] && MPARAM="${MPARAM}--filesystem "
+[[ -z "${VOLNAME}" ]] && MPARAM="${MPARAM}--pvname "
+[[ -z "${VOLSIZE}" ]] && MPARAM="${MPARAM}--size "
+[[ -z "${PVC}" ]] && MPARAM="${MPARAM}--pvc "
+
+if [ ! -z "$MPARAM" ]; then
+   echo "ERROR: Mandatory parameter missing : $MPARAM"
+   usage
+fi
+
+if [[ ! ${VOLSIZE} =~ ^[1-9][0-9]*$ ]]; then
+    echo "ERROR: Provided value for --size=${VOLSIZE} is not valid number"
+    exit 2
+fi
+
+if ! [[ "${PVC}" =~ ^[^/]+/[^/]+$ ]]; then
+    echo "ERROR: Provided value for --pvc=${PVC} must be <namespace>/<name>"
+    exit 2
+fi
+PVCNAMESPACE=${PVC%%/*}
+PVCNAME=${PVC##*/}
+
+[[ -z "${ACCESSMODE}" ]] && ACCESSMODE="ReadWriteMany"
+
+if ! [[ "$ACCESSMODE" == "ReadWriteMany" || "$ACCESSMODE" == "ReadWriteOnce" ]]
+then
+        echo "ERROR: Invalid access mode specified. Valid accessmode are ReadWriteMany and ReadWriteOnce."
+        exit 2
+fi
+
+STORAGECLASS=""
+if ! [[ -z "${CLASS}" ]] ; then
+	if ! [[ "${CLASS}" =~ ^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$ ]]; then
+		echo "ERROR: Invalid storageClass name specified. storageClass name must satisfy DNS-1123 label requirement."
+		exit 2
+	fi
+	STORAGECLASS="storageClassName: ${CLASS}"
+fi
+
+# Parse the existing volume handle, version 1 handles have positional fields
+clusterID=""
+fileSystemID=""
+filesetID=""
+volType="dir"
+LINKPATH=""
+if [[ "${VOLHANDLE}" == v2\;* ]]; then
+	if [[ "${VOLHANDLE}" == *\;mode=direct\;* ]]; then
+		echo "ERROR: Volume handle ${VOLHANDLE} already uses direct path mode"
+		exit 2
+	fi
+	LINKPATH=${VOLHANDLE#*;path=}
+	IFS=';' read -ra FIELDS <<< "${VOLHANDLE%%;path=*}"
+	for field in "${FIELDS[@]}"; do
+		case "${field%%=*}" in
+			cid ) clusterID=${field#*=} ;;
+			fsuuid ) fileSystemID=${field#*=} ;;
+			type ) volType=${field#*=} ;;
+			fsetid ) filesetID=${field#*=} ;;
+		esac
+	done
+else
+	IFS=';' read -ra FIELDS <<< "${VOLHANDLE}"
+	clusterID=${FIELDS[0]}
+	fileSystemID=${FIELDS[1]}
+	if [[ ${#FIELDS[@]} -eq 4 ]]; then
+		volType="fileset"
+		filesetID=${FIELDS[2]#fileset=}
+		LINKPATH=${FIELDS[3]#path=}
+	elif [[ ${#FIELDS[@]} -eq 3 ]]; then
+		LINKPATH=${FIELDS[2]#path=}
+	fi
+fi
+
+if [[ -z "${clusterID}" ]] || [[ -z "${fileSystemID}" ]] || [[ -z "${LINKPATH}" ]]; then
+	echo "ERROR: Invalid volume handle ${VOLHANDLE}"
+	exit 2
+fi
+
+if [[ "${volType}" == "fileset" ]] && [[ -z "${filesetID}" ]]; then
+	echo "ERROR: Fileset ID missing in volume handle ${VOLHANDLE}"
+	exit 2
+fi
+
+# Check if this is spectrum scale node
+if [[ ! -f /usr/lpp/mmfs/bin/mmlscluster ]] ; then
+    echo "ERROR: Spectrum Scale cli's are not present on this node"
+    exit 2
+fi
+
+echo > ${ERROROUT}
+
+# The volume handle must reference the given filesystem
+fsUID=`/usr/lpp/mmfs/bin/mmlsfs ${FSNAME} --uid 2>${ERROROUT}  | tail -1 | awk '{split($0,a," "); print a[2]}'`
+if [[ $? -ne 0 ]] || [[ -z "$fsUID" ]]; then
+     echo "ERROR: Failed to get the Fileystem ID of ${FSNAME}"
+     cat ${ERROROUT}
+     exit 2
+fi
+
+if [[ "${fsUID}" != "${fileSystemID}" ]]; then
+	echo "ERROR: Filesystem ID ${fileSystemID} in volume handle does not match ID ${fsUID} of filesystem ${FSNAME}"
+	exit 2
+fi
+
+# Resolve the symlink of the volume in the primary fileset
+if [ ! -L "${LINKPATH}" ]; then
+	echo "ERROR: Path (${LINKPATH}) does not exist or it is not a Softlink."
+        exit 2
+fi
+
+DATAPATH=`readlink -f "${LINKPATH}"`
+if [[ $? -ne 0 ]] || [[ ! -d "${DATAPATH}" ]]; then
+	echo "ERROR: Target of softlink (${LINKPATH}) does not exist or it is not a Directory."
+        exit 2
+fi
+
+if [[ "${DATAPATH}" == *\;* ]]; then
+	echo "ERROR: Path (${DATAPATH}) must not contain ';'"
+        exit 2
+fi
+
+# Check if data path is gpfs path
+/usr/lpp/mmfs/bin/mmlsattr ${DATAPATH} &> /dev/null
+if [[ $? -ne 0 ]]; then
+	echo "ERROR: The Path (${DATAPATH}) is not gpfs path"
+        exit 2
+fi
+
+# Generate Volume Handle
+VolumeHandle="v2;cid=${clusterID};fsuuid=${fileSystemID};fs=${FSNAME}"
+if [[ "${volType}" == "fileset" ]]; then
+	VolumeHandle="${VolumeHandle};fsetid=${filesetID}"
+fi
+VolumeHandle="${VolumeHandle};mode=direct;path=${DATAPATH}"
+
+# Gererate yaml file
+generate_yaml "${VolumeHandle}" "${VOLNAME}" "${VOLSIZE}" "${ACCESSMODE}" "${PVCNAMESPACE}" "${PVCNAME}"
+
+echo "INFO: Data path of the volume: ${DATAPATH}"
+echo "INFO: Symlink which can be removed after migration: ${LINKPATH}"
+echo "INFO: Run $0 --help for the steps to recreate the pv"
+
+rm -f ${ERROROUT}
+exit 0
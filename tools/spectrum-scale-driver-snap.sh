@@ -90,6 +90,8 @@ echo "The log files will be saved in the folder [$logdir]"
 
 csi_spectrum_scale_attacher_log_name=${logdir}/ibm-spectrum-scale-csi-attacher.log
 csi_spectrum_scale_provisioner_log_name=${logdir}/ibm-spectrum-scale-csi-provisioner.log
+csi_spectrum_scale_resizer_log_name=${logdir}/ibm-spectrum-scale-csi-resizer.log
+csi_spectrum_scale_snapshotter_log_name=${logdir}/ibm-spectrum-scale-csi-snapshotter.log
 
 describe_all_per_label=${logdir}/ibm-spectrum-scale-csi-describe-all-by-label
 get_all_per_label=${logdir}/ibm-spectrum-scale-csi-get-all-by-label
@@ -100,7 +102,9 @@ describe_CSIScaleOperator=${logdir}/ibm-spectrum-scale-csi-describe-CSIScaleOper
 echo "$klog StatefulSet/ibm-spectrum-scale-csi-attacher"
 $klog StatefulSet/ibm-spectrum-scale-csi-attacher > ${csi_spectrum_scale_attacher_log_name} 2>&1 || :
 echo "$klog StatefulSet/ibm-spectrum-scale-csi-provisioner"
-$klog StatefulSet/ibm-spectrum-scale-csi-provisioner > ${csi_spectrum_scale_provisioner_log_name} 2>&1 || :
+$klog StatefulSet/ibm-spectrum-scale-csi-provisioner -c ibm-spectrum-scale-csi-provisioner > ${csi_spectrum_scale_provisioner_log_name} 2>&1 || :
+$klog StatefulSet/ibm-spectrum-scale-csi-provisioner -c ibm-spectrum-scale-csi-resizer > ${csi_spectrum_scale_resizer_log_name} 2>&1 || :
+$klog StatefulSet/ibm-spectrum-scale-csi-provisioner -c ibm-spectrum-scale-csi-snapshotter > ${csi_spectrum_scale_snapshotter_log_name} 2>&1 || :
 
 # kubectl logs on csi pods
 for csi_pod in `$cmd get pod -l app=ibm-spectrum-scale-csi --namespace $ns | grep -v NAME | awk '{print $1}'`; do
@@ -81,6 +81,14 @@ def validateImages(conf_dict):
              print "Mandatory parameter 'attacher' in IMAGES section missing"
              exit(1)
 
+        if conf_dict.get("resizer") == "" or conf_dict.get("resizer") == None:
+             print "Mandatory parameter 'resizer' in IMAGES section missing"
+             exit(1)
+
+        if conf_dict.get("snapshotter") == "" or conf_dict.get("snapshotter") == None:
+             print "Mandatory parameter 'snapshotter' in IMAGES section missing"
+             exit(1)
+
         if conf_dict.get("driverregistrar") == "" or conf_dict.get("driverregistrar") == None:
              print "Mandatory parameter 'driverregistrar' in IMAGES section missing"
              exit(1)